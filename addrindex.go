@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+// maps PubKeyHash, height, txid, direction and index to AddressEvent,
+// exists only if the node runs with -addrindex
+const addrIndexBucket = "addrindex"
+
+// set by startnode -addrindex, builds the address index of an existing chain
+var addrIndexEnabled = false
+
+var errNoAddressIndex = errors.New("There is no address index, start the node with -addrindex to build it.")
+
+// AddressEvent is an output paid to an address (funding) or an input spending one (spending).
+type AddressEvent struct {
+	Height   int
+	TxID     []byte
+	Spending bool
+	// the output of a funding event, the input of a spending event
+	Index int
+	Value int
+	// the output spent by a spending event
+	PrevTxID []byte
+	PrevVout int
+}
+
+func (e AddressEvent) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(e)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeAddressEvent(data []byte) AddressEvent {
+	var event AddressEvent
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&event)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return event
+}
+
+// addressEventKey orders the events of an address by height, so that a
+// cursor seeking the PubKeyHash finds the history in chain order.
+func addressEventKey(pubKeyHash []byte, e AddressEvent) []byte {
+	height := make([]byte, 4)
+	binary.BigEndian.PutUint32(height, uint32(e.Height))
+	direction := []byte{0}
+	if e.Spending {
+		direction[0] = 1
+	}
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(e.Index))
+
+	return bytes.Join([][]byte{pubKeyHash, height, e.TxID, direction, index}, []byte{})
+}
+
+// txAddressEvents adds the events of tx in the block at height to events.
+// fetch must return the outputs spent by tx.
+func txAddressEvents(events map[string]AddressEvent, tx *Transaction, height int, fetch func(txid []byte, vout int) (TXOutput, bool)) {
+	if !tx.IsCoinbase() {
+		for i, vin := range tx.Vin {
+			out, ok := fetch(vin.Txid, vin.Vout)
+			if !ok {
+				log.Panicf("ERROR: Output %x:%d spent by %x is not found", vin.Txid, vin.Vout, tx.ID)
+			}
+
+			e := AddressEvent{height, tx.ID, true, i, out.Value, vin.Txid, vin.Vout}
+			events[string(addressEventKey(out.PubKeyHash, e))] = e
+		}
+	}
+
+	for i, out := range tx.Vout {
+		e := AddressEvent{Height: height, TxID: tx.ID, Index: i, Value: out.Value}
+		events[string(addressEventKey(out.PubKeyHash, e))] = e
+	}
+}
+
+func (bc *Blockchain) HasAddressIndex() bool {
+	exists := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket([]byte(addrIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return exists
+}
+
+// BuildAddressIndex indexes the whole chain from scratch and returns the
+// number of events. Connected blocks are indexed from then on.
+func (bc *Blockchain) BuildAddressIndex() int {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	count := 0
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucketName := []byte(addrIndexBucket)
+
+		err := tx.DeleteBucket(bucketName)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			log.Panic(err)
+		}
+
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// the blocks are read in this transaction, another one could block it
+		blocks := tx.Bucket([]byte(blocksBucket))
+		var hashes [][]byte
+		for hash := bc.tip; len(hash) > 0; {
+			hashes = append(hashes, hash)
+			hash = DeserializeBlock(blocks.Get(hash)).PrevBlockHash
+		}
+
+		// replays the chain from the genesis block to get the spent values
+		outputs := make(map[string]TXOutput)
+		for i := len(hashes) - 1; i >= 0; i-- {
+			block := DeserializeBlock(blocks.Get(hashes[i]))
+
+			events := make(map[string]AddressEvent)
+			for _, transaction := range block.Transactions {
+				txAddressEvents(events, transaction, block.Height, func(txid []byte, vout int) (TXOutput, bool) {
+					out, ok := outputs[outpointKey(txid, vout)]
+					return out, ok
+				})
+
+				if !transaction.IsCoinbase() {
+					for _, vin := range transaction.Vin {
+						delete(outputs, outpointKey(vin.Txid, vin.Vout))
+					}
+				}
+				for outIdx, out := range transaction.Vout {
+					outputs[outpointKey(transaction.ID, outIdx)] = out
+				}
+			}
+
+			for key, e := range events {
+				err := b.Put([]byte(key), e.Serialize())
+				if err != nil {
+					log.Panic(err)
+				}
+				count++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return count
+}
+
+// blockAddressEvents returns the events of a block for the address index, nil
+// without one. It must be called before the block is applied to the UTXO set.
+func (bc *Blockchain) blockAddressEvents(block *Block) map[string]AddressEvent {
+	if !bc.HasAddressIndex() {
+		return nil
+	}
+
+	view := NewUTXOView(UTXOSet{bc})
+	events := make(map[string]AddressEvent)
+	for _, tx := range block.Transactions {
+		txAddressEvents(events, tx, block.Height, view.FetchOutput)
+		view.Connect(tx)
+	}
+
+	return events
+}
+
+// indexAddresses adds events to the address index, if there is one.
+func indexAddresses(tx *bolt.Tx, events map[string]AddressEvent) error {
+	b := tx.Bucket([]byte(addrIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for key, e := range events {
+		err := b.Put([]byte(key), e.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddressHistory returns the events of pubKeyHash in chain order.
+func (bc *Blockchain) AddressHistory(pubKeyHash []byte) ([]AddressEvent, error) {
+	var history []AddressEvent
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addrIndexBucket))
+		if b == nil {
+			return errNoAddressIndex
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(pubKeyHash); k != nil && bytes.HasPrefix(k, pubKeyHash); k, v = c.Next() {
+			history = append(history, DeserializeAddressEvent(v))
+		}
+
+		return nil
+	})
+
+	return history, err
+}
+
+// AddressUTXOs returns the funding events of pubKeyHash whose outputs are unspent.
+func (bc *Blockchain) AddressUTXOs(pubKeyHash []byte) ([]AddressEvent, error) {
+	history, err := bc.AddressHistory(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := make(map[string]bool)
+	for _, e := range history {
+		if e.Spending {
+			spent[outpointKey(e.PrevTxID, e.PrevVout)] = true
+		}
+	}
+
+	var utxos []AddressEvent
+	for _, e := range history {
+		if !e.Spending && !spent[outpointKey(e.TxID, e.Index)] {
+			utxos = append(utxos, e)
+		}
+	}
+
+	return utxos, nil
+}
+
+// AddressBalance sums the unspent outputs of pubKeyHash, through the address
+// index if there is one, otherwise by scanning the UTXO set.
+func (bc *Blockchain) AddressBalance(pubKeyHash []byte) int {
+	utxos, err := bc.AddressUTXOs(pubKeyHash)
+	if err != nil {
+		balance, _ := UTXOSet{bc}.FindUTXO(pubKeyHash)
+		return balance
+	}
+
+	balance := 0
+	for _, e := range utxos {
+		balance += e.Value
+	}
+
+	return balance
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"log"
 	"time"
@@ -16,13 +17,23 @@ type Block struct {
 	Height        int
 }
 
+// BlockHeader is a block without transactions. The merkle root stands for them,
+// so the pow of a header can be checked on its own.
+type BlockHeader struct {
+	Timestamp     int64
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Hash          []byte
+	Nonce         int
+	Height        int
+}
+
 func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int) *Block {
 	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0, height}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	err := NewCPUMiner(minerThreads).Solve(context.Background(), block)
+	if err != nil {
+		log.Panic(err)
+	}
 
 	return block
 }
@@ -45,6 +56,10 @@ func isGenesisBlock(b *Block) bool {
 	return false
 }
 
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{b.Timestamp, b.PrevBlockHash, b.HashTransactions(), b.Hash, b.Nonce, b.Height}
+}
+
 func (b *Block) HashTransactions() []byte {
 	var transactions [][]byte
 
@@ -81,3 +96,27 @@ func DeserializeBlock(d []byte) *Block {
 
 	return &block
 }
+
+func (h BlockHeader) Serialize() []byte {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(h)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeBlockHeader(d []byte) BlockHeader {
+	var header BlockHeader
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&header)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return header
+}
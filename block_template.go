@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// upper bound on the serialized size of a mined block
+var maxBlockSize = 1000000
+
+// BlockTemplate is the content of the next block to mine: a coinbase paying
+// the subsidy plus fees, followed by the selected transactions, parents first.
+type BlockTemplate struct {
+	PrevBlockHash []byte
+	Height        int
+	Transactions  []*Transaction
+	Fees          int
+	Size          int
+	// the lowest ancestor fee rate (fee per byte) of the selected transactions
+	MinFeeRate float64
+	// invalid or conflicting candidates which should leave the mempool
+	Rejected []*Transaction
+}
+
+// templateEntry is a candidate transaction together with its in-mempool relatives.
+type templateEntry struct {
+	tx       *Transaction
+	id       string
+	fee      int
+	size     int
+	parents  []*templateEntry
+	children []*templateEntry
+}
+
+// NewBlockTemplate selects transactions from candidates by ancestor fee rate,
+// i.e. the fee rate of a transaction together with its unconfirmed ancestors,
+// until the block reaches maxSize bytes.
+func NewBlockTemplate(u *UTXOSet, candidates []*Transaction, minerAddress string, maxSize int) *BlockTemplate {
+	height, prevHash := u.Blockchain.GetBestHeight()
+	template := &BlockTemplate{PrevBlockHash: prevHash, Height: height + 1}
+
+	entries := make(map[string]*templateEntry)
+	for _, tx := range candidates {
+		if tx.IsCoinbase() {
+			continue
+		}
+		id := hex.EncodeToString(tx.ID)
+		entries[id] = &templateEntry{tx: tx, id: id, size: len(tx.Serialize())}
+	}
+
+	// link each entry with the candidates it spends from
+	for _, entry := range entries {
+		for _, vin := range entry.tx.Vin {
+			parent, ok := entries[hex.EncodeToString(vin.Txid)]
+			if ok && !containsEntry(entry.parents, parent) {
+				entry.parents = append(entry.parents, parent)
+				parent.children = append(parent.children, entry)
+			}
+		}
+	}
+
+	// compute the fees on top of the chainstate and the outputs of the other
+	// candidates. Conflicts between candidates are caught when they are added.
+	view := NewUTXOView(*u)
+	for _, entry := range entries {
+		for outIdx, out := range entry.tx.Vout {
+			view.added[outpointKey(entry.tx.ID, outIdx)] = out
+		}
+	}
+	for _, entry := range entries {
+		fee, ok := view.CheckTransaction(entry.tx)
+		if !ok {
+			template.reject(entries, entry)
+			continue
+		}
+		entry.fee = fee
+	}
+
+	coinbaseData := fmt.Sprintf("Height %d", template.Height)
+	// the coinbase value is not known yet, but it doesn't change its size much
+	template.Size = len(NewCoinbaseTX(minerAddress, coinbaseData).Serialize())
+
+	// the transactions are connected to a fresh view one after another
+	view = NewUTXOView(*u)
+	var selected []*Transaction
+
+	for len(entries) > 0 {
+		best, pkg := bestPackage(entries)
+
+		pkgFee, pkgSize := 0, 0
+		for _, entry := range pkg {
+			pkgFee += entry.fee
+			pkgSize += entry.size
+		}
+		if template.Size+pkgSize > maxSize {
+			// it doesn't fit, but its ancestors may still be selected alone
+			skipEntry(entries, best)
+			continue
+		}
+
+		feeRate := float64(pkgFee) / float64(pkgSize)
+		if len(selected) == 0 || feeRate < template.MinFeeRate {
+			template.MinFeeRate = feeRate
+		}
+
+		for _, entry := range pkg {
+			fee, ok := view.CheckTransaction(entry.tx)
+			if !ok {
+				template.reject(entries, entry)
+				break
+			}
+
+			view.Connect(entry.tx)
+			selected = append(selected, entry.tx)
+			template.Fees += fee
+			template.Size += entry.size
+			removeEntry(entries, entry)
+		}
+	}
+
+	cbTx := NewCoinbaseTXValue(minerAddress, coinbaseData, subsidy+template.Fees)
+	template.Transactions = append([]*Transaction{cbTx}, selected...)
+
+	return template
+}
+
+// reject drops an entry and all of its descendants.
+func (t *BlockTemplate) reject(entries map[string]*templateEntry, entry *templateEntry) {
+	if _, ok := entries[entry.id]; !ok {
+		return
+	}
+
+	t.Rejected = append(t.Rejected, entry.tx)
+	removeEntry(entries, entry)
+
+	for _, child := range entry.children {
+		t.reject(entries, child)
+	}
+}
+
+// bestPackage returns the entry with the highest ancestor fee rate together
+// with its remaining ancestors, sorted so that parents come before children.
+func bestPackage(entries map[string]*templateEntry) (*templateEntry, []*templateEntry) {
+	var best *templateEntry
+	var bestPkg []*templateEntry
+	bestFee, bestSize := 0, 1
+
+	for _, entry := range entries {
+		pkg := ancestorPackage(entries, entry)
+		fee, size := 0, 0
+		for _, e := range pkg {
+			fee += e.fee
+			size += e.size
+		}
+
+		// compare fee/size with bestFee/bestSize without losing precision
+		better := best == nil || fee*bestSize > bestFee*size
+		if !better && fee*bestSize == bestFee*size {
+			// break ties deterministically
+			better = size < bestSize || (size == bestSize && entry.id < best.id)
+		}
+
+		if better {
+			best, bestPkg = entry, pkg
+			bestFee, bestSize = fee, size
+		}
+	}
+
+	return best, bestPkg
+}
+
+func ancestorPackage(entries map[string]*templateEntry, entry *templateEntry) []*templateEntry {
+	var pkg []*templateEntry
+	depth := make(map[*templateEntry]int)
+
+	var visit func(e *templateEntry) int
+	visit = func(e *templateEntry) int {
+		if d, ok := depth[e]; ok {
+			return d
+		}
+
+		d := 0
+		for _, parent := range e.parents {
+			// selected ancestors are in the block already
+			if _, ok := entries[parent.id]; ok {
+				if pd := visit(parent) + 1; pd > d {
+					d = pd
+				}
+			}
+		}
+		depth[e] = d
+		pkg = append(pkg, e)
+
+		return d
+	}
+	visit(entry)
+
+	sort.SliceStable(pkg, func(i, j int) bool {
+		if depth[pkg[i]] != depth[pkg[j]] {
+			return depth[pkg[i]] < depth[pkg[j]]
+		}
+		return bytes.Compare(pkg[i].tx.ID, pkg[j].tx.ID) < 0
+	})
+
+	return pkg
+}
+
+// skipEntry leaves an entry and its descendants for a later block.
+func skipEntry(entries map[string]*templateEntry, entry *templateEntry) {
+	if _, ok := entries[entry.id]; !ok {
+		return
+	}
+
+	removeEntry(entries, entry)
+	for _, child := range entry.children {
+		skipEntry(entries, child)
+	}
+}
+
+func removeEntry(entries map[string]*templateEntry, entry *templateEntry) {
+	delete(entries, entry.id)
+}
+
+func containsEntry(list []*templateEntry, target *templateEntry) bool {
+	for _, e := range list {
+		if e == target {
+			return true
+		}
+	}
+	return false
+}
@@ -2,15 +2,17 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/btcec/v2"
 )
 
 const dbFile = "blockchain_%s.db"
@@ -20,8 +22,17 @@ const genesisCoinbaseData = "Should I? Can I?"
 type Blockchain struct {
 	tip []byte
 	db  *bolt.DB
+	// whose wallet the transactions of connected blocks are tracked for
+	nodeID string
+
+	// serializes the verification and connection of blocks
+	lock sync.Mutex
+	// closed and replaced whenever the tip changes
+	tipChanged chan struct{}
 }
 
+var errStaleBlock = errors.New("Block does not extend the tip any more.")
+
 func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	var block Block
 	var blockData []byte
@@ -86,7 +97,8 @@ func CopyGenesisBlock(nodeID string, block *Block) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{tip: tip, db: db, nodeID: nodeID}
+	bc.trackWalletBlock(genesis)
 
 	return &bc
 }
@@ -131,10 +143,11 @@ func CreateBlockchain(address, nodeID string) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{tip: tip, db: db, nodeID: nodeID}
 
 	utxo := UTXOSet{&bc}
 	utxo.Reindex()
+	bc.trackWalletBlock(genesis)
 
 	return &bc
 
@@ -163,13 +176,17 @@ func NewBlockchain(nodeID string) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{tip: tip, db: db, nodeID: nodeID}
 
 	return &bc
 
 }
 
+// AddBlock stores block as the tip together with its entries in the indexes
+// and its filter, in one transaction so that a stop can't leave them behind.
 func (bc *Blockchain) AddBlock(block *Block) {
+	events := bc.blockAddressEvents(block)
+
 	err := bc.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 
@@ -184,6 +201,21 @@ func (bc *Blockchain) AddBlock(block *Block) {
 			log.Panic(err)
 		}
 
+		err = indexAddresses(tx, events)
+		if err != nil {
+			return err
+		}
+
+		err = indexTransactions(tx, block)
+		if err != nil {
+			return err
+		}
+
+		err = indexFilter(tx, block)
+		if err != nil {
+			return err
+		}
+
 		bc.tip = block.Hash
 
 		return nil
@@ -201,23 +233,12 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 }
 
 func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
-	bci := bc.Iterator()
-
-	for {
-		block := bci.Next()
-
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+	block, position, err := bc.LocateTransaction(ID)
+	if err != nil {
+		return Transaction{}, err
 	}
 
-	return Transaction{}, errors.New("Transaction is not found")
+	return *block.Transactions[position], nil
 }
 
 // map[txid] = [UTXOs]
@@ -291,6 +312,60 @@ func (bc *Blockchain) GetBestHeight() (int, []byte) {
 	return lastBlock.Height, lastBlock.Hash
 }
 
+func (bc *Blockchain) GetBlockHashByHeight(height int) ([]byte, error) {
+	bestHeight, _ := bc.GetBestHeight()
+	if height < 0 || height > bestHeight {
+		return nil, errors.New("Block height is out of range.")
+	}
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+
+		if block.Height == height {
+			return block.Hash, nil
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, errors.New("Block is not found.")
+}
+
+// GetHeaders returns up to count headers starting with the block startHash towards the tip.
+func (bc *Blockchain) GetHeaders(startHash []byte, count int) ([]BlockHeader, error) {
+	var blocks []*Block
+	found := false
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+
+		if bytes.Compare(block.Hash, startHash) == 0 {
+			found = true
+			break
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	if !found {
+		return nil, errors.New("Block is not found.")
+	}
+
+	var headers []BlockHeader
+	for i := len(blocks) - 1; i >= 0 && len(headers) < count; i-- {
+		headers = append(headers, blocks[i].Header())
+	}
+
+	return headers, nil
+}
+
 func (bc *Blockchain) GetBlockHashes() [][]byte {
 	var blocks [][]byte
 	bci := bc.Iterator()
@@ -308,28 +383,92 @@ func (bc *Blockchain) GetBlockHashes() [][]byte {
 	return blocks
 }
 
-func (bc *Blockchain) MineBlock(transactions []*Transaction, UTXOSet *UTXOSet) *Block {
-
-	lastHeight, lastHash := UTXOSet.Blockchain.GetBestHeight()
+// MineBlock mines a block with transactions on top of the tip and connects it.
+// Mining is aborted when ctx is done or another block extends the tip first.
+func (bc *Blockchain) MineBlock(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	tipChanged := bc.TipChanged()
+	lastHeight, lastHash := bc.GetBestHeight()
 
 	block := &Block{time.Now().Unix(), transactions, lastHash, []byte{}, 0, lastHeight + 1}
-	if UTXOSet.VerifyBlock(block, false) == false {
-		log.Panic("ERROR: Invalid Block")
+	utxo := UTXOSet{bc}
+	if utxo.VerifyBlock(block, false) == false {
+		return nil, errors.New("ERROR: Invalid Block")
 	}
 
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tipChanged:
+			fmt.Println("The tip has changed, stop mining.")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	err := NewCPUMiner(minerThreads).Solve(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bc.ConnectBlock(block) {
+		return nil, errStaleBlock
+	}
+
+	return block, nil
+}
+
+// MineTransactions mines txs in a block of their own and pays the reward to minerAddress.
+func (bc *Blockchain) MineTransactions(txs []*Transaction, minerAddress string) (*Block, error) {
+	utxo := UTXOSet{bc}
+	template := NewBlockTemplate(&utxo, txs, minerAddress, maxBlockSize)
+	if len(template.Rejected) > 0 {
+		return nil, errors.New("ERROR: Invalid transaction")
+	}
+
+	return bc.MineBlock(context.Background(), template.Transactions)
+}
+
+// ConnectBlock verifies block against the tip and the chainstate, then adds it
+// and updates the UTXO set.
+func (bc *Blockchain) ConnectBlock(block *Block) bool {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	utxo := UTXOSet{bc}
+	start := time.Now()
+	valid := utxo.VerifyBlock(block, true)
+	metrics.ObserveBlockValidation(time.Since(start))
+	if !valid {
+		return false
+	}
 
 	bc.AddBlock(block)
+	bc.trackWalletBlock(block)
+	utxo.Update(block)
+	publishBlockConnected(block)
+
+	if bc.tipChanged != nil {
+		close(bc.tipChanged)
+		bc.tipChanged = nil
+	}
 
-	return block
+	return true
+}
+
+// TipChanged returns a channel which is closed when the next block is connected.
+func (bc *Blockchain) TipChanged() <-chan struct{} {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	if bc.tipChanged == nil {
+		bc.tipChanged = make(chan struct{})
+	}
 
+	return bc.tipChanged
 }
 
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey *btcec.PrivateKey) {
 	tx.Sign(privKey)
 }
 
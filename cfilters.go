@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/boltdb/bolt"
+)
+
+// maps block hash to BlockFilter
+const cfiltersBucket = "cfilters"
+
+const maxCFiltersPerRequest = 1000
+const maxCFHeadersPerRequest = 2000
+
+// BlockFilter is the compact filter of a block and its filter header, which
+// commits to the filter and all filters before it.
+type BlockFilter struct {
+	Filter []byte
+	Header []byte
+}
+
+type getcfilters struct {
+	AddrFrom    string
+	StartHeight int
+	StopHash    []byte
+}
+
+// cfilters answers getcfilters with the filters of the blocks from StartHeight to StopHash.
+type cfilters struct {
+	StopHash    []byte
+	BlockHashes [][]byte
+	Filters     [][]byte
+	Error       string
+}
+
+type getcfheaders struct {
+	AddrFrom    string
+	StartHeight int
+	StopHash    []byte
+}
+
+// cfheaders answers getcfheaders. The filter headers can be rebuilt from
+// PrevFilterHeader, the header before StartHeight, and the filter hashes.
+type cfheaders struct {
+	StopHash         []byte
+	PrevFilterHeader []byte
+	FilterHashes     [][]byte
+	Error            string
+}
+
+func (f BlockFilter) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(f)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeBlockFilter(data []byte) BlockFilter {
+	var filter BlockFilter
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&filter)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return filter
+}
+
+// outpointBytes is the filter item of a spent output.
+func outpointBytes(txid []byte, vout int) []byte {
+	index := make([]byte, 4)
+	binary.LittleEndian.PutUint32(index, uint32(vout))
+
+	return append(append([]byte{}, txid...), index...)
+}
+
+// blockFilterKey keys the hashes of a filter with the first 16 bytes of the block hash.
+func blockFilterKey(blockHash []byte) [16]byte {
+	var key [16]byte
+	copy(key[:], blockHash)
+
+	return key
+}
+
+// NewBlockFilter puts the PubKeyHash of every output and every spent outpoint of block in a filter.
+func NewBlockFilter(block *Block) *GCSFilter {
+	var items [][]byte
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				items = append(items, outpointBytes(vin.Txid, vin.Vout))
+			}
+		}
+
+		for _, out := range tx.Vout {
+			items = append(items, out.PubKeyHash)
+		}
+	}
+
+	return NewGCSFilter(blockFilterKey(block.Hash), items, gcsP, gcsM)
+}
+
+func filterHash(filter []byte) []byte {
+	hash := sha256.Sum256(filter)
+	return hash[:]
+}
+
+// filterHeader chains the filter hash to the previous filter header. The
+// genesis block's previous header is zero.
+func filterHeader(filterHash, prevHeader []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, filterHash...), prevHeader...))
+	return hash[:]
+}
+
+// BuildFilters computes the filters of the blocks after the last one which
+// has a filter up to the tip, of the whole chain if none has. Connected
+// blocks get their filter from then on.
+func (bc *Blockchain) BuildFilters() int {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	count := 0
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(cfiltersBucket))
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// the blocks are read in this transaction, another one could block it
+		blocks := tx.Bucket([]byte(blocksBucket))
+		var hashes [][]byte
+		prevHeader := make([]byte, sha256.Size)
+		for hash := bc.tip; len(hash) > 0; {
+			if data := b.Get(hash); data != nil {
+				prevHeader = DeserializeBlockFilter(data).Header
+				break
+			}
+
+			hashes = append(hashes, hash)
+			hash = DeserializeBlock(blocks.Get(hash)).PrevBlockHash
+		}
+
+		for i := len(hashes) - 1; i >= 0; i-- {
+			block := DeserializeBlock(blocks.Get(hashes[i]))
+			filter := NewBlockFilter(block).Bytes()
+			header := filterHeader(filterHash(filter), prevHeader)
+
+			err := b.Put(block.Hash, BlockFilter{filter, header}.Serialize())
+			if err != nil {
+				log.Panic(err)
+			}
+			prevHeader = header
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return count
+}
+
+// indexFilter stores the filter of a connected block, if the chain has filters.
+func indexFilter(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(cfiltersBucket))
+	if b == nil {
+		return nil
+	}
+
+	// the genesis block chains to the zero header
+	prevHeader := make([]byte, sha256.Size)
+	if len(block.PrevBlockHash) > 0 {
+		prev := b.Get(block.PrevBlockHash)
+		if prev == nil {
+			return fmt.Errorf("Filter of block %x is not found", block.PrevBlockHash)
+		}
+		prevHeader = DeserializeBlockFilter(prev).Header
+	}
+
+	filter := NewBlockFilter(block).Bytes()
+	header := filterHeader(filterHash(filter), prevHeader)
+
+	return b.Put(block.Hash, BlockFilter{filter, header}.Serialize())
+}
+
+func (bc *Blockchain) GetBlockFilter(blockHash []byte) (BlockFilter, error) {
+	var filter BlockFilter
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cfiltersBucket))
+		if b == nil {
+			return errors.New("There are no block filters.")
+		}
+
+		data := b.Get(blockHash)
+		if data == nil {
+			return errors.New("Block filter is not found.")
+		}
+
+		filter = DeserializeBlockFilter(data)
+		return nil
+	})
+
+	return filter, err
+}
+
+// blockRange returns the blocks from startHeight up to stopHash, at most max of them.
+func (bc *Blockchain) blockRange(startHeight int, stopHash []byte, max int) ([]*Block, error) {
+	block, err := bc.GetBlock(stopHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if startHeight < 0 || startHeight > block.Height {
+		return nil, errors.New("Start height is out of range.")
+	}
+	if block.Height-startHeight+1 > max {
+		return nil, fmt.Errorf("At most %d blocks can be requested.", max)
+	}
+
+	blocks := make([]*Block, block.Height-startHeight+1)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		current := block
+		blocks[i] = &current
+
+		if i > 0 {
+			block, err = bc.GetBlock(block.PrevBlockHash)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+func handleGetCFilters(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload getcfilters
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	response := cfilters{StopHash: payload.StopHash}
+	if bc == nil {
+		response.Error = "I don't have a blockchain."
+		respond(conn, "cfilters", response)
+		return
+	}
+
+	blocks, err := bc.blockRange(payload.StartHeight, payload.StopHash, maxCFiltersPerRequest)
+	if err != nil {
+		response.Error = err.Error()
+		respond(conn, "cfilters", response)
+		return
+	}
+
+	for _, block := range blocks {
+		filter, err := bc.GetBlockFilter(block.Hash)
+		if err != nil {
+			response = cfilters{StopHash: payload.StopHash, Error: err.Error()}
+			break
+		}
+
+		response.BlockHashes = append(response.BlockHashes, block.Hash)
+		response.Filters = append(response.Filters, filter.Filter)
+	}
+
+	respond(conn, "cfilters", response)
+}
+
+func handleGetCFHeaders(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload getcfheaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	response := cfheaders{StopHash: payload.StopHash}
+	if bc == nil {
+		response.Error = "I don't have a blockchain."
+		respond(conn, "cfheaders", response)
+		return
+	}
+
+	blocks, err := bc.blockRange(payload.StartHeight, payload.StopHash, maxCFHeadersPerRequest)
+	if err != nil {
+		response.Error = err.Error()
+		respond(conn, "cfheaders", response)
+		return
+	}
+
+	response.PrevFilterHeader = make([]byte, sha256.Size)
+	if len(blocks[0].PrevBlockHash) > 0 {
+		prev, err := bc.GetBlockFilter(blocks[0].PrevBlockHash)
+		if err != nil {
+			respond(conn, "cfheaders", cfheaders{StopHash: payload.StopHash, Error: err.Error()})
+			return
+		}
+		response.PrevFilterHeader = prev.Header
+	}
+
+	for _, block := range blocks {
+		filter, err := bc.GetBlockFilter(block.Hash)
+		if err != nil {
+			respond(conn, "cfheaders", cfheaders{StopHash: payload.StopHash, Error: err.Error()})
+			return
+		}
+
+		response.FilterHashes = append(response.FilterHashes, filterHash(filter.Filter))
+	}
+
+	respond(conn, "cfheaders", response)
+}
+
+// requestCFilters asks the node at addr for the filters of the blocks from startHeight to stopHash.
+func requestCFilters(addr string, startHeight int, stopHash []byte) (*cfilters, error) {
+	payload := gobEncode(getcfilters{nodeAddress, startHeight, stopHash})
+	response, err := requestData(addr, append(commandToBytes("getcfilters"), payload...))
+	if err != nil {
+		return nil, err
+	}
+
+	var result cfilters
+	err = gob.NewDecoder(bytes.NewReader(response[commandLength:])).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return &result, nil
+}
+
+// requestCFHeaders asks the node at addr for the filter hashes of the blocks
+// from startHeight to stopHash, and returns the filter headers built from them.
+func requestCFHeaders(addr string, startHeight int, stopHash []byte) ([][]byte, error) {
+	payload := gobEncode(getcfheaders{nodeAddress, startHeight, stopHash})
+	response, err := requestData(addr, append(commandToBytes("getcfheaders"), payload...))
+	if err != nil {
+		return nil, err
+	}
+
+	var result cfheaders
+	err = gob.NewDecoder(bytes.NewReader(response[commandLength:])).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	var headers [][]byte
+	prevHeader := result.PrevFilterHeader
+	for _, hash := range result.FilterHashes {
+		prevHeader = filterHeader(hash, prevHeader)
+		headers = append(headers, prevHeader)
+	}
+
+	return headers, nil
+}
+
+// VerifyCFilters checks the filters against the filter headers of the same blocks.
+func VerifyCFilters(filters *cfilters, headers [][]byte, prevHeader []byte) error {
+	if len(filters.Filters) != len(headers) {
+		return errors.New("The number of filters and filter headers differs.")
+	}
+
+	for i, filter := range filters.Filters {
+		if !bytes.Equal(filterHeader(filterHash(filter), prevHeader), headers[i]) {
+			return fmt.Errorf("Filter of block %x doesn't match its header.", filters.BlockHashes[i])
+		}
+		prevHeader = headers[i]
+	}
+
+	return nil
+}
+
+// FilterMatcher tells a light wallet which blocks pay to its addresses or
+// spend its outputs.
+type FilterMatcher struct {
+	items [][]byte
+}
+
+func NewFilterMatcher(pubKeyHashes [][]byte) *FilterMatcher {
+	return &FilterMatcher{append([][]byte{}, pubKeyHashes...)}
+}
+
+// AddOutpoint watches the output for being spent.
+func (m *FilterMatcher) AddOutpoint(txid []byte, vout int) {
+	m.items = append(m.items, outpointBytes(txid, vout))
+}
+
+// Match reports whether the block probably concerns the wallet.
+func (m *FilterMatcher) Match(blockHash, filter []byte) bool {
+	f, err := ParseGCSFilter(filter, gcsP, gcsM)
+	if err != nil {
+		return false
+	}
+
+	return f.MatchAny(blockFilterKey(blockHash), m.items)
+}
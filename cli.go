@@ -8,18 +8,60 @@ import (
 	"os"
 )
 
-type CLI struct{}
+type CLI struct {
+	// talks to a running node if set, otherwise the files of NODE_ID are used
+	client *RPCClient
+}
 
 func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
+	fmt.Println("  abortrescan - Stop the rescanblockchain of the running node after the current block")
 	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  combinepsbt -psbts PSBTS - Merge the signatures and data of comma-separated PSBTs of the same transaction")
+	fmt.Println("  createpsbt -inputs JSON -outputs PAYMENTS - Print a PSBT, a partially signed transaction, of what createrawtransaction creates")
+	fmt.Println("  createrawtransaction -inputs JSON -outputs PAYMENTS - Print an unsigned transaction spending the txid/vout pairs of JSON and paying PAYMENTS, address/amount pairs as JSON or CSV. What the outputs leave of the inputs is the fee")
+	fmt.Println("  createwallet -change -schnorr - Generates a new key-pair and saves it into the wallet file, the next key of the change chain with -change if the wallet is HD, a key signing by Schnorr with -schnorr")
+	fmt.Println("  createwallet -mnemonic -words N -passphrase PASSPHRASE -account N - Start an HD wallet from a new mnemonic of N words, which backs up all its addresses")
+	fmt.Println("  decodepsbt -psbt PSBT - Print the inputs, outputs, signatures and fee of PSBT")
+	fmt.Println("  decoderawtransaction -hex HEX - Print the transaction serialized in HEX")
+	fmt.Println("  encryptwallet -passphrase PASSPHRASE - Encrypt the private keys and the seed of the wallet, sending needs walletpassphrase then")
+	fmt.Println("  extractpsbt -psbt PSBT - Print the signed transaction of a finalized PSBT for sendrawtransaction")
+	fmt.Println("  finalizepsbt -psbt PSBT - Put the signature of every signed input of PSBT in place")
+	fmt.Println("  getaddresshistory -address ADDRESS - List the outputs received and spent by ADDRESS, using the address index")
+	fmt.Println("  getaddressutxos -address ADDRESS - List the unspent outputs of ADDRESS, using the address index")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  gettransaction -txid TXID - Print the transaction TXID and the block containing it, using the txindex if there is one")
+	fmt.Println("  getwalletinfo - Print the number of keys, watch-only addresses and transactions of the wallet and its balances")
+	fmt.Println("  importaddress -address ADDRESS -rescan - Watch ADDRESS without its key, its transactions are tracked from the next block on, or from the genesis block with -rescan")
+	fmt.Println("  importpubkey -pubkey PUBKEY -rescan - Watch the address of the hex public key PUBKEY")
 	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
+	fmt.Println("  listtransactions -count N -skip N - List N transactions of the wallet before the last N skipped ones with their net amount and confirmations")
+	fmt.Println("  miner -node NODE -address ADDRESS -threads N - Mine for the node at NODE (localhost:NODE_ID by default) with N threads and send rewards to ADDRESS")
 	fmt.Println("  printchain - Print all the blocks of the blockchain")
 	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT -mine - Send AMOUNT of coins from FROM address to TO. Mine on the same node, when -mine is set.")
-	fmt.Println("  startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
+	fmt.Println("  rescanblockchain -from HEIGHT -to HEIGHT - Rebuild the wallet transactions of the blocks from HEIGHT to HEIGHT (the tip by default) for the keys and watch-only addresses, Ctrl-C aborts")
+	fmt.Println("  restorewallet -mnemonic MNEMONIC -passphrase PASSPHRASE -account N -gap N - Restore an HD wallet and the addresses the blockchain has used, looking N addresses ahead")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT -mine -coinselect STRATEGY -feerate RATE - Send AMOUNT of coins from FROM address to TO. Mine on the same node, when -mine is set. STRATEGY picks the coins: auto, bnb, largest, smallest or random, RATE is the fee in coins per 1000 bytes")
+	fmt.Println("  sendmany -from FROM -file FILE -mine -coinselect STRATEGY -feerate RATE -dryrun - Pay every address/amount pair of FILE, JSON or CSV, from FROM in one transaction and report the total and fee. With -dryrun print the signed transaction instead of sending it")
+	fmt.Println("  sendrawtransaction -hex HEX - Relay the signed transaction serialized in HEX")
+	fmt.Println("  setmining -pause -resume - Pause or resume mining on the running node")
+	fmt.Println("  signpsbt -psbt PSBT -privkeys KEYS - Sign the inputs of PSBT with the wallet, or only with KEYS, comma-separated hex private keys")
+	fmt.Println("  signrawtransaction -hex HEX -prevtxs JSON -privkeys KEYS - Sign the inputs of the transaction in HEX with the wallet, or only with KEYS, comma-separated hex private keys. JSON lists the txid/vout/address/amount of the outputs spent when the blockchain doesn't have them")
+	fmt.Println("  updatepsbt -psbt PSBT - Add the outputs the inputs spend from the blockchain and the derivation paths of the HD keys of the wallet to PSBT")
+	fmt.Println("  walletlock - Lock the wallet of the running node")
+	fmt.Println("  walletpassphrase -passphrase PASSPHRASE -timeout SECONDS - Unlock the wallet of the running node for SECONDS")
+	fmt.Println("  startnode -miner ADDRESS -blockmaxsize SIZE -minerthreads N -blockinterval DURATION - Start a node with ID specified in NODE_ID env. var. -miner enables mining of blocks up to SIZE bytes with N threads every DURATION")
+	fmt.Println("    -rpcport PORT -rpcuser USER -rpcpassword PASSWORD - Serve JSON-RPC on localhost:PORT for USER")
+	fmt.Println("    -rest - Serve the read-only REST interface under /rest/ on the RPC port without authentication")
+	fmt.Println("    -explorer - Serve the block explorer under /explorer/ on the RPC port without authentication")
+	fmt.Println("    -txindex - Index all transactions by txid, existing chains are indexed at startup")
+	fmt.Println("    -addrindex - Index the outputs received and spent by every address, existing chains are indexed at startup")
+	fmt.Println("    -metrics - Serve Prometheus metrics under /metrics on the RPC port without authentication")
+	fmt.Println("    -spv - Run a light node which syncs block headers and merkle proofs of the wallet transactions from the full node")
+	fmt.Println()
+	fmt.Println("All commands but miner and startnode talk to a running node when -rpcport or RPC_PORT is set:")
+	fmt.Println("  -rpcconnect HOST -rpcport PORT -rpcuser USER -rpcpassword PASSWORD - RPC_CONNECT, RPC_PORT, RPC_USER and RPC_PASSWORD env. vars by default")
+	fmt.Println("  -direct - Open the blockchain and wallet files of NODE_ID instead")
 }
 
 func (cli *CLI) validateArgs() {
@@ -43,44 +85,255 @@ func (cli *CLI) Run() {
 		os.Exit(1)
 	}
 
+	getAddressHistoryCmd := flag.NewFlagSet("getaddresshistory", flag.ExitOnError)
+	getAddressUTXOsCmd := flag.NewFlagSet("getaddressutxos", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+	abortRescanCmd := flag.NewFlagSet("abortrescan", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
+	combinePSBTCmd := flag.NewFlagSet("combinepsbt", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	createRawTransactionCmd := flag.NewFlagSet("createrawtransaction", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	decodePSBTCmd := flag.NewFlagSet("decodepsbt", flag.ExitOnError)
+	decodeRawTransactionCmd := flag.NewFlagSet("decoderawtransaction", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	extractPSBTCmd := flag.NewFlagSet("extractpsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
+	getWalletInfoCmd := flag.NewFlagSet("getwalletinfo", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	importPubKeyCmd := flag.NewFlagSet("importpubkey", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	minerCmd := flag.NewFlagSet("miner", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	rescanBlockchainCmd := flag.NewFlagSet("rescanblockchain", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	sendRawTransactionCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	setMiningCmd := flag.NewFlagSet("setmining", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	signRawTransactionCmd := flag.NewFlagSet("signrawtransaction", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	updatePSBTCmd := flag.NewFlagSet("updatepsbt", flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+
+	getAddressHistoryRPC := addRPCFlags(getAddressHistoryCmd)
+	getAddressUTXOsRPC := addRPCFlags(getAddressUTXOsCmd)
+	getBalanceRPC := addRPCFlags(getBalanceCmd)
+	abortRescanRPC := addRPCFlags(abortRescanCmd)
+	createBlockchainRPC := addRPCFlags(createBlockchainCmd)
+	combinePSBTRPC := addRPCFlags(combinePSBTCmd)
+	createPSBTRPC := addRPCFlags(createPSBTCmd)
+	createRawTransactionRPC := addRPCFlags(createRawTransactionCmd)
+	createWalletRPC := addRPCFlags(createWalletCmd)
+	decodePSBTRPC := addRPCFlags(decodePSBTCmd)
+	decodeRawTransactionRPC := addRPCFlags(decodeRawTransactionCmd)
+	encryptWalletRPC := addRPCFlags(encryptWalletCmd)
+	extractPSBTRPC := addRPCFlags(extractPSBTCmd)
+	finalizePSBTRPC := addRPCFlags(finalizePSBTCmd)
+	getWalletInfoRPC := addRPCFlags(getWalletInfoCmd)
+	getTransactionRPC := addRPCFlags(getTransactionCmd)
+	importAddressRPC := addRPCFlags(importAddressCmd)
+	importPubKeyRPC := addRPCFlags(importPubKeyCmd)
+	listAddressesRPC := addRPCFlags(listAddressesCmd)
+	listTransactionsRPC := addRPCFlags(listTransactionsCmd)
+	printChainRPC := addRPCFlags(printChainCmd)
+	reindexUTXORPC := addRPCFlags(reindexUTXOCmd)
+	rescanBlockchainRPC := addRPCFlags(rescanBlockchainCmd)
+	restoreWalletRPC := addRPCFlags(restoreWalletCmd)
+	sendRPC := addRPCFlags(sendCmd)
+	sendManyRPC := addRPCFlags(sendManyCmd)
+	sendRawTransactionRPC := addRPCFlags(sendRawTransactionCmd)
+	setMiningRPC := addRPCFlags(setMiningCmd)
+	signPSBTRPC := addRPCFlags(signPSBTCmd)
+	signRawTransactionRPC := addRPCFlags(signRawTransactionCmd)
+	updatePSBTRPC := addRPCFlags(updatePSBTCmd)
+	walletLockRPC := addRPCFlags(walletLockCmd)
+	walletPassphraseRPC := addRPCFlags(walletPassphraseCmd)
 
+	getAddressHistoryAddress := getAddressHistoryCmd.String("address", "", "The address to list the history of")
+	getAddressUTXOsAddress := getAddressUTXOsCmd.String("address", "", "The address to list the unspent outputs of")
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	combinePSBTPSBTs := combinePSBTCmd.String("psbts", "", "Comma-separated PSBTs to combine")
+	createPSBTInputs := createPSBTCmd.String("inputs", "", "JSON array of the txid/vout pairs to spend")
+	createPSBTOutputs := createPSBTCmd.String("outputs", "", "Address/amount pairs to pay, JSON or CSV")
+	createRawTransactionInputs := createRawTransactionCmd.String("inputs", "", "JSON array of the txid/vout pairs to spend")
+	createRawTransactionOutputs := createRawTransactionCmd.String("outputs", "", "Address/amount pairs to pay, JSON or CSV")
+	createWalletChange := createWalletCmd.Bool("change", false, "Generate a change address")
+	createWalletSchnorr := createWalletCmd.Bool("schnorr", false, "Generate an address spent with Schnorr signatures")
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Start an HD wallet from a new mnemonic")
+	createWalletWords := createWalletCmd.Int("words", 12, "Number of words of the mnemonic: 12, 15, 18, 21 or 24")
+	createWalletPassphrase := createWalletCmd.String("passphrase", "", "Optional passphrase protecting the mnemonic")
+	createWalletAccount := createWalletCmd.Uint("account", 0, "Account of the HD keys")
+	decodePSBTPSBT := decodePSBTCmd.String("psbt", "", "The PSBT")
+	decodeRawTransactionHex := decodeRawTransactionCmd.String("hex", "", "The serialized transaction")
+	encryptWalletPassphrase := encryptWalletCmd.String("passphrase", "", "The passphrase to encrypt the wallet with")
+	extractPSBTPSBT := extractPSBTCmd.String("psbt", "", "The finalized PSBT")
+	finalizePSBTPSBT := finalizePSBTCmd.String("psbt", "", "The PSBT")
+	getTransactionTxID := getTransactionCmd.String("txid", "", "The transaction to look up")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	importAddressRescan := importAddressCmd.Bool("rescan", false, "Rescan the blockchain for the transactions of the address")
+	importPubKeyPubKey := importPubKeyCmd.String("pubkey", "", "The hex public key to watch")
+	importPubKeyRescan := importPubKeyCmd.Bool("rescan", false, "Rescan the blockchain for the transactions of the address")
+	listTransactionsCount := listTransactionsCmd.Int("count", 10, "Number of transactions to list")
+	listTransactionsSkip := listTransactionsCmd.Int("skip", 0, "Number of the latest transactions to skip")
+	minerNode := minerCmd.String("node", fmt.Sprintf("localhost:%s", nodeID), "Address of the node to mine for")
+	minerAddress := minerCmd.String("address", "", "The address to send block rewards to")
+	minerThreadCount := minerCmd.Int("threads", minerThreads, "Number of mining threads")
+	rescanBlockchainFrom := rescanBlockchainCmd.Int("from", 0, "The height to rescan from")
+	rescanBlockchainTo := rescanBlockchainCmd.Int("to", -1, "The height to rescan to, the tip if negative")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "The mnemonic of the wallet")
+	restoreWalletPassphrase := restoreWalletCmd.String("passphrase", "", "The passphrase of the mnemonic")
+	restoreWalletAccount := restoreWalletCmd.Uint("account", 0, "Account of the HD keys")
+	restoreWalletGap := restoreWalletCmd.Int("gap", hdGapLimit, "Number of unused addresses to look ahead")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendCoinSelect := sendCmd.String("coinselect", defaultCoinSelector, "Coin selection strategy: "+CoinSelectorNames())
+	sendFeeRate := sendCmd.Float64("feerate", 0, "Fee in coins per 1000 bytes")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyFile := sendManyCmd.String("file", "", "JSON or CSV file of address/amount pairs")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendManyCoinSelect := sendManyCmd.String("coinselect", defaultCoinSelector, "Coin selection strategy: "+CoinSelectorNames())
+	sendManyFeeRate := sendManyCmd.Float64("feerate", 0, "Fee in coins per 1000 bytes")
+	sendManyDryRun := sendManyCmd.Bool("dryrun", false, "Report and print the transaction without sending it")
+	sendRawTransactionHex := sendRawTransactionCmd.String("hex", "", "The signed serialized transaction")
+	signPSBTPSBT := signPSBTCmd.String("psbt", "", "The PSBT")
+	signPSBTPrivKeys := signPSBTCmd.String("privkeys", "", "Comma-separated hex private keys to sign with instead of the wallet")
+	signRawTransactionHex := signRawTransactionCmd.String("hex", "", "The serialized transaction")
+	signRawTransactionPrevTxs := signRawTransactionCmd.String("prevtxs", "", "JSON array of the txid/vout/address/amount of the outputs spent")
+	signRawTransactionPrivKeys := signRawTransactionCmd.String("privkeys", "", "Comma-separated hex private keys to sign with instead of the wallet")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodeBlockMaxSize := startNodeCmd.Int("blockmaxsize", maxBlockSize, "Maximum size of mined blocks in bytes")
+	startNodeMinerThreads := startNodeCmd.Int("minerthreads", minerThreads, "Number of mining threads")
+	startNodeBlockInterval := startNodeCmd.Duration("blockinterval", miningInterval, "Target time between mined blocks, 0 mines continuously")
+	startNodeRPCPort := startNodeCmd.String("rpcport", os.Getenv("RPC_PORT"), "Serve JSON-RPC on this port")
+	startNodeRPCUser := startNodeCmd.String("rpcuser", os.Getenv("RPC_USER"), "User name for JSON-RPC")
+	startNodeRPCPassword := startNodeCmd.String("rpcpassword", os.Getenv("RPC_PASSWORD"), "Password for JSON-RPC")
+	startNodeREST := startNodeCmd.Bool("rest", false, "Serve the REST interface on the RPC port")
+	startNodeExplorer := startNodeCmd.Bool("explorer", false, "Serve the block explorer on the RPC port")
+	startNodeMetrics := startNodeCmd.Bool("metrics", false, "Serve Prometheus metrics on the RPC port")
+	startNodeTxIndex := startNodeCmd.Bool("txindex", false, "Maintain the transaction index")
+	startNodeAddrIndex := startNodeCmd.Bool("addrindex", false, "Maintain the address index")
+	startNodeSPV := startNodeCmd.Bool("spv", false, "Run a light node which keeps only headers and wallet transactions")
+	setMiningPause := setMiningCmd.Bool("pause", false, "Pause mining")
+	setMiningResume := setMiningCmd.Bool("resume", false, "Resume mining")
+	updatePSBTPSBT := updatePSBTCmd.String("psbt", "", "The PSBT")
+	walletPassphrasePassphrase := walletPassphraseCmd.String("passphrase", "", "The passphrase of the wallet")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 60, "Seconds until the wallet is locked again")
 
 	switch os.Args[1] {
+	case "getaddresshistory":
+		err := getAddressHistoryCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getaddressutxos":
+		err := getAddressUTXOsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "abortrescan":
+		err := abortRescanCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createblockchain":
 		err := createBlockchainCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "combinepsbt":
+		err := combinePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createpsbt":
+		err := createPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createrawtransaction":
+		err := createRawTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "decodepsbt":
+		err := decodePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "decoderawtransaction":
+		err := decodeRawTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "extractpsbt":
+		err := extractPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "finalizepsbt":
+		err := finalizePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getwalletinfo":
+		err := getWalletInfoCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importaddress":
+		err := importAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importpubkey":
+		err := importPubKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "miner":
+		err := minerCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "printchain":
 		err := printChainCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -91,22 +344,91 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "rescanblockchain":
+		err := rescanBlockchainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtransaction":
+		err := sendRawTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "setmining":
+		err := setMiningCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signpsbt":
+		err := signPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signrawtransaction":
+		err := signRawTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "updatepsbt":
+		err := updatePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletlock":
+		err := walletLockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
+	if getAddressHistoryCmd.Parsed() {
+		cli.client = getAddressHistoryRPC.client()
+		if *getAddressHistoryAddress == "" {
+			getAddressHistoryCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getAddressHistory(*getAddressHistoryAddress, nodeID)
+	}
+
+	if getAddressUTXOsCmd.Parsed() {
+		cli.client = getAddressUTXOsRPC.client()
+		if *getAddressUTXOsAddress == "" {
+			getAddressUTXOsCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getAddressUTXOs(*getAddressUTXOsAddress, nodeID)
+	}
+
 	if getBalanceCmd.Parsed() {
+		cli.client = getBalanceRPC.client()
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
 			os.Exit(1)
@@ -114,7 +436,13 @@ func (cli *CLI) Run() {
 		cli.getBalance(*getBalanceAddress, nodeID)
 	}
 
+	if abortRescanCmd.Parsed() {
+		cli.client = abortRescanRPC.client()
+		cli.abortRescan()
+	}
+
 	if createBlockchainCmd.Parsed() {
+		cli.client = createBlockchainRPC.client()
 		if *createBlockchainAddress == "" {
 			createBlockchainCmd.Usage()
 			os.Exit(1)
@@ -122,29 +450,262 @@ func (cli *CLI) Run() {
 		cli.createBlockchain(*createBlockchainAddress, nodeID)
 	}
 
+	if combinePSBTCmd.Parsed() {
+		cli.client = combinePSBTRPC.client()
+		if *combinePSBTPSBTs == "" {
+			combinePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.combinePSBT(*combinePSBTPSBTs)
+	}
+
+	if createPSBTCmd.Parsed() {
+		cli.client = createPSBTRPC.client()
+		if *createPSBTInputs == "" || *createPSBTOutputs == "" {
+			createPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createPSBT(*createPSBTInputs, *createPSBTOutputs)
+	}
+
+	if createRawTransactionCmd.Parsed() {
+		cli.client = createRawTransactionRPC.client()
+		if *createRawTransactionInputs == "" || *createRawTransactionOutputs == "" {
+			createRawTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createRawTransaction(*createRawTransactionInputs, *createRawTransactionOutputs)
+	}
+
 	if createWalletCmd.Parsed() {
-		cli.createWallet(nodeID)
+		cli.client = createWalletRPC.client()
+		if *createWalletAccount >= hardenedKeyStart {
+			createWalletCmd.Usage()
+			os.Exit(1)
+		}
+		if *createWalletMnemonic {
+			cli.createHDWallet(nodeID, *createWalletWords, *createWalletPassphrase, uint32(*createWalletAccount))
+		} else {
+			if *createWalletChange && *createWalletSchnorr {
+				createWalletCmd.Usage()
+				os.Exit(1)
+			}
+			cli.createWallet(nodeID, *createWalletChange, *createWalletSchnorr)
+		}
+	}
+
+	if decodePSBTCmd.Parsed() {
+		cli.client = decodePSBTRPC.client()
+		if *decodePSBTPSBT == "" {
+			decodePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.decodePSBT(*decodePSBTPSBT)
+	}
+
+	if decodeRawTransactionCmd.Parsed() {
+		cli.client = decodeRawTransactionRPC.client()
+		if *decodeRawTransactionHex == "" {
+			decodeRawTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.decodeRawTransaction(*decodeRawTransactionHex)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.client = encryptWalletRPC.client()
+		if *encryptWalletPassphrase == "" {
+			encryptWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.encryptWallet(*encryptWalletPassphrase, nodeID)
+	}
+
+	if extractPSBTCmd.Parsed() {
+		cli.client = extractPSBTRPC.client()
+		if *extractPSBTPSBT == "" {
+			extractPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.extractPSBT(*extractPSBTPSBT)
+	}
+
+	if finalizePSBTCmd.Parsed() {
+		cli.client = finalizePSBTRPC.client()
+		if *finalizePSBTPSBT == "" {
+			finalizePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.finalizePSBT(*finalizePSBTPSBT)
+	}
+
+	if getWalletInfoCmd.Parsed() {
+		cli.client = getWalletInfoRPC.client()
+		cli.getWalletInfo(nodeID)
+	}
+
+	if getTransactionCmd.Parsed() {
+		cli.client = getTransactionRPC.client()
+		if *getTransactionTxID == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getTransaction(*getTransactionTxID, nodeID)
+	}
+
+	if importAddressCmd.Parsed() {
+		cli.client = importAddressRPC.client()
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importAddress(*importAddressAddress, *importAddressRescan, nodeID)
+	}
+
+	if importPubKeyCmd.Parsed() {
+		cli.client = importPubKeyRPC.client()
+		if *importPubKeyPubKey == "" {
+			importPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPubKey(*importPubKeyPubKey, *importPubKeyRescan, nodeID)
 	}
 
 	if listAddressesCmd.Parsed() {
+		cli.client = listAddressesRPC.client()
 		cli.listAddresses(nodeID)
 	}
 
+	if listTransactionsCmd.Parsed() {
+		cli.client = listTransactionsRPC.client()
+		if *listTransactionsCount < 0 || *listTransactionsSkip < 0 {
+			listTransactionsCmd.Usage()
+			os.Exit(1)
+		}
+		cli.listTransactions(*listTransactionsCount, *listTransactionsSkip, nodeID)
+	}
+
+	if minerCmd.Parsed() {
+		if *minerAddress == "" {
+			minerCmd.Usage()
+			os.Exit(1)
+		}
+		cli.miner(*minerNode, *minerAddress, *minerThreadCount)
+	}
+
 	if printChainCmd.Parsed() {
+		cli.client = printChainRPC.client()
 		cli.printChain(nodeID)
 	}
 
 	if reindexUTXOCmd.Parsed() {
+		cli.client = reindexUTXORPC.client()
 		cli.reindexUTXO(nodeID)
 	}
 
+	if rescanBlockchainCmd.Parsed() {
+		cli.client = rescanBlockchainRPC.client()
+		if *rescanBlockchainFrom < 0 {
+			rescanBlockchainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.rescanBlockchain(*rescanBlockchainFrom, *rescanBlockchainTo, nodeID)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		cli.client = restoreWalletRPC.client()
+		if *restoreWalletMnemonic == "" || *restoreWalletGap <= 0 || *restoreWalletAccount >= hardenedKeyStart {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.restoreWallet(*restoreWalletMnemonic, *restoreWalletPassphrase, uint32(*restoreWalletAccount), *restoreWalletGap, nodeID)
+	}
+
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		cli.client = sendRPC.client()
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFeeRate < 0 {
+			sendCmd.Usage()
+			os.Exit(1)
+		}
+		if _, ok := coinSelectors[*sendCoinSelect]; !ok {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine, *sendCoinSelect, *sendFeeRate)
+	}
+
+	if sendManyCmd.Parsed() {
+		cli.client = sendManyRPC.client()
+		if *sendManyFrom == "" || *sendManyFile == "" || *sendManyFeeRate < 0 {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+		if _, ok := coinSelectors[*sendManyCoinSelect]; !ok {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.sendMany(*sendManyFrom, *sendManyFile, nodeID, *sendManyMine, *sendManyCoinSelect, *sendManyFeeRate, *sendManyDryRun)
+	}
+
+	if sendRawTransactionCmd.Parsed() {
+		cli.client = sendRawTransactionRPC.client()
+		if *sendRawTransactionHex == "" {
+			sendRawTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendRawTransaction(*sendRawTransactionHex)
+	}
+
+	if setMiningCmd.Parsed() {
+		cli.client = setMiningRPC.client()
+		if *setMiningPause == *setMiningResume {
+			setMiningCmd.Usage()
+			os.Exit(1)
+		}
+		cli.setMining(nodeID, *setMiningPause)
+	}
+
+	if signPSBTCmd.Parsed() {
+		cli.client = signPSBTRPC.client()
+		if *signPSBTPSBT == "" {
+			signPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signPSBT(*signPSBTPSBT, *signPSBTPrivKeys, nodeID)
+	}
+
+	if signRawTransactionCmd.Parsed() {
+		cli.client = signRawTransactionRPC.client()
+		if *signRawTransactionHex == "" {
+			signRawTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signRawTransaction(*signRawTransactionHex, *signRawTransactionPrevTxs, *signRawTransactionPrivKeys, nodeID)
+	}
+
+	if updatePSBTCmd.Parsed() {
+		cli.client = updatePSBTRPC.client()
+		if *updatePSBTPSBT == "" {
+			updatePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		cli.updatePSBT(*updatePSBTPSBT, nodeID)
+	}
+
+	if walletLockCmd.Parsed() {
+		cli.client = walletLockRPC.client()
+		cli.walletLock()
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		cli.client = walletPassphraseRPC.client()
+		if *walletPassphrasePassphrase == "" || *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			os.Exit(1)
+		}
+		cli.walletPassphrase(*walletPassphrasePassphrase, *walletPassphraseTimeout)
 	}
 
 	if startNodeCmd.Parsed() {
@@ -154,6 +715,19 @@ func (cli *CLI) Run() {
 			startNodeCmd.Usage()
 			os.Exit(1)
 		}
-		cli.startNode(nodeID, *startNodeMiner)
+		maxBlockSize = *startNodeBlockMaxSize
+		minerThreads = *startNodeMinerThreads
+		miningInterval = *startNodeBlockInterval
+		txIndexEnabled = *startNodeTxIndex
+		addrIndexEnabled = *startNodeAddrIndex
+		rpc := RPCConfig{Port: *startNodeRPCPort, User: *startNodeRPCUser, Password: *startNodeRPCPassword, REST: *startNodeREST, Explorer: *startNodeExplorer, Metrics: *startNodeMetrics}
+		if *startNodeSPV {
+			if *startNodeMiner != "" || rpc.Port != "" || txIndexEnabled || addrIndexEnabled {
+				log.Panic("An SPV node can't mine, serve RPC or keep indexes!")
+			}
+			cli.startSPVNode(nodeID)
+		} else {
+			cli.startNode(nodeID, *startNodeMiner, rpc)
+		}
 	}
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// abortRescan stops the rescan which the node runs.
+func (cli *CLI) abortRescan() {
+	if cli.client == nil {
+		log.Panic("abortrescan stops the rescan of a running node, set -rpcport!")
+	}
+
+	var aborted bool
+	err := cli.client.Call("abortrescan", nil, &aborted)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if aborted {
+		fmt.Println("The rescan is aborting")
+	} else {
+		fmt.Println("There is no rescan running")
+	}
+}
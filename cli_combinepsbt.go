@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// combinePSBT merges psbts, comma-separated, of the same transaction.
+func (cli *CLI) combinePSBT(psbts string) {
+	var psbtList []string
+	for _, psbt := range strings.Split(psbts, ",") {
+		psbtList = append(psbtList, strings.TrimSpace(psbt))
+	}
+
+	if cli.client != nil {
+		var result string
+		err := cli.client.Call("combinepsbt", []interface{}{psbtList}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(result)
+		return
+	}
+
+	combined, err := ParsePSBT(psbtList[0])
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, psbt := range psbtList[1:] {
+		p, err := ParsePSBT(psbt)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		err = combined.Combine(p)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	fmt.Println(combined.Serialize())
+}
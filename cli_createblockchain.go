@@ -9,6 +9,17 @@ func (cli *CLI) createBlockchain(address, nodeID string) {
 	if !ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
+
+	if cli.client != nil {
+		err := cli.client.Call("createblockchain", []interface{}{address}, nil)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println("Done")
+		return
+	}
+
 	bc := CreateBlockchain(address, nodeID)
 	defer bc.db.Close()
 
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// createPSBT prints a PSBT of the transaction which createrawtransaction would create.
+func (cli *CLI) createPSBT(inputs, outputs string) {
+	var rawInputs []RawInput
+	err := json.Unmarshal([]byte(inputs), &rawInputs)
+	if err != nil {
+		log.Panic(err)
+	}
+	payments, err := ParsePayments([]byte(outputs))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if cli.client != nil {
+		var psbt string
+		err := cli.client.Call("createpsbt", []interface{}{rawInputs, payments}, &psbt)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(psbt)
+		return
+	}
+
+	tx, err := CreateRawTransaction(rawInputs, payments)
+	if err != nil {
+		log.Panic(err)
+	}
+	p, err := NewPSBT(tx)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(p.Serialize())
+}
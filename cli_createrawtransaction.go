@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// createRawTransaction prints an unsigned transaction spending inputs, a JSON
+// array of txid/vout pairs, and paying outputs, JSON or CSV as sendmany takes them.
+func (cli *CLI) createRawTransaction(inputs, outputs string) {
+	var rawInputs []RawInput
+	err := json.Unmarshal([]byte(inputs), &rawInputs)
+	if err != nil {
+		log.Panic(err)
+	}
+	payments, err := ParsePayments([]byte(outputs))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if cli.client != nil {
+		var txHex string
+		err := cli.client.Call("createrawtransaction", []interface{}{rawInputs, payments}, &txHex)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(txHex)
+		return
+	}
+
+	tx, err := CreateRawTransaction(rawInputs, payments)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(hex.EncodeToString(tx.Serialize()))
+}
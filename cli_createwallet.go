@@ -1,11 +1,68 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) createWallet(nodeID string, change, schnorr bool) {
+	if cli.client != nil {
+		method := "getnewaddress"
+		var params []interface{}
+		if change {
+			method = "getrawchangeaddress"
+		} else if schnorr {
+			params = []interface{}{"schnorr"}
+		}
+
+		var address string
+		err := cli.client.Call(method, params, &address)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Your new address: %s\n", address)
+		return
+	}
 
-func (cli *CLI) createWallet(nodeID string) {
 	wallets, _ := NewWallets(nodeID)
-	address := wallets.CreateWallet()
+	var address string
+	if change {
+		address = wallets.CreateChangeWallet()
+	} else if schnorr {
+		address = wallets.CreateSchnorrWallet()
+	} else {
+		address = wallets.CreateWallet()
+	}
 	wallets.SaveToFile(nodeID)
 
 	fmt.Printf("Your new address: %s\n", address)
 }
+
+// createHDWallet starts a wallet whose keys all derive from a new mnemonic.
+func (cli *CLI) createHDWallet(nodeID string, words int, passphrase string, account uint32) {
+	var result CreateWalletJSON
+
+	if cli.client != nil {
+		err := cli.client.Call("createwallet", []interface{}{words, passphrase, account}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		mnemonic, err := NewMnemonic(words)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		wallets, err := NewHDWallets(nodeID, mnemonic, passphrase, account)
+		if err != nil {
+			log.Panic(err)
+		}
+		result = CreateWalletJSON{mnemonic, wallets.CreateWallet()}
+		wallets.SaveToFile(nodeID)
+	}
+
+	fmt.Println("Write down your mnemonic, it restores all addresses of the wallet:")
+	fmt.Println(result.Mnemonic)
+	fmt.Printf("Your new address: %s\n", result.Address)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) decodePSBT(psbt string) {
+	var result DecodedPSBTJSON
+	if cli.client != nil {
+		err := cli.client.Call("decodepsbt", []interface{}{psbt}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		p, err := ParsePSBT(psbt)
+		if err != nil {
+			log.Panic(err)
+		}
+		result = NewDecodedPSBTJSON(p)
+	}
+
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(string(out))
+}
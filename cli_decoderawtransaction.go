@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) decodeRawTransaction(txHex string) {
+	if cli.client != nil {
+		var result TxJSON
+		err := cli.client.Call("decoderawtransaction", []interface{}{txHex}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	tx, err := DecodeRawTransaction(txHex)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(tx)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) encryptWallet(passphrase, nodeID string) {
+	if cli.client != nil {
+		var message string
+		err := cli.client.Call("encryptwallet", []interface{}{passphrase}, &message)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(message)
+		return
+	}
+
+	wallets, err := NewWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = wallets.Encrypt(passphrase)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	fmt.Println("Wallet encrypted, unlock it with walletpassphrase to send coins")
+}
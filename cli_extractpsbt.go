@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// extractPSBT prints the signed transaction of a finalized PSBT for sendrawtransaction.
+func (cli *CLI) extractPSBT(psbt string) {
+	if cli.client != nil {
+		var txHex string
+		err := cli.client.Call("extractpsbt", []interface{}{psbt}, &txHex)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(txHex)
+		return
+	}
+
+	p, err := ParsePSBT(psbt)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println(hex.EncodeToString(tx.Serialize()))
+}
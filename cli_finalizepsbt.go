@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) finalizePSBT(psbt string) {
+	var result PSBTJSON
+	if cli.client != nil {
+		err := cli.client.Call("finalizepsbt", []interface{}{psbt}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		p, err := ParsePSBT(psbt)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		complete := p.Finalize()
+		result = PSBTJSON{PSBT: p.Serialize(), Complete: complete}
+	}
+
+	fmt.Println(result.PSBT)
+	printPSBTComplete(result.Complete)
+}
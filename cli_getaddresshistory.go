@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) getAddressHistory(address, nodeID string) {
+	for _, e := range cli.addressEvents("getaddresshistory", address, nodeID, (*Blockchain).AddressHistory) {
+		if e.Type == "spending" {
+			fmt.Printf("%d %s:%d spends %s:%d -%d\n", e.Height, e.TxID, e.Index, e.PrevTxID, e.PrevVout, e.Value)
+		} else {
+			fmt.Printf("%d %s:%d receives +%d\n", e.Height, e.TxID, e.Index, e.Value)
+		}
+	}
+}
+
+// addressEvents calls method on the running node, or lookup on the address index of NODE_ID.
+func (cli *CLI) addressEvents(method, address, nodeID string, lookup func(*Blockchain, []byte) ([]AddressEvent, error)) []AddressEventJSON {
+	if !ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+
+	var result []AddressEventJSON
+	if cli.client != nil {
+		err := cli.client.Call(method, []interface{}{address}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		return result
+	}
+
+	bc := NewBlockchain(nodeID)
+	defer bc.db.Close()
+
+	events, err := lookup(bc, AddressToPubKeyHash(address))
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, e := range events {
+		result = append(result, NewAddressEventJSON(e))
+	}
+
+	return result
+}
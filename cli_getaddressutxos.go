@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (cli *CLI) getAddressUTXOs(address, nodeID string) {
+	total := 0
+	for _, e := range cli.addressEvents("getaddressutxos", address, nodeID, (*Blockchain).AddressUTXOs) {
+		fmt.Printf("%s:%d %d (height %d)\n", e.TxID, e.Index, e.Value, e.Height)
+		total += e.Value
+	}
+
+	fmt.Printf("Balance of '%s': %d\n", address, total)
+}
@@ -9,13 +9,23 @@ func (cli *CLI) getBalance(address, nodeID string) {
 	if !ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
+
+	if cli.client != nil {
+		var balance int
+		err := cli.client.Call("getbalance", []interface{}{address}, &balance)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Balance of '%s': %d\n", address, balance)
+		return
+	}
+
 	bc := NewBlockchain(nodeID)
-	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	pubKeyHash := Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	balance, _ := UTXOSet.FindUTXO(pubKeyHash)
+	pubKeyHash := AddressToPubKeyHash(address)
+	balance := bc.AddressBalance(pubKeyHash)
 
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
 }
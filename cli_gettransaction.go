@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) getTransaction(txID, nodeID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil || len(ID) == 0 {
+		log.Panic("ERROR: Txid is not valid")
+	}
+
+	var info TxInfoJSON
+	if cli.client != nil {
+		err := cli.client.Call("gettransaction", []interface{}{txID}, &info)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+
+		if !bc.HasTxIndex() {
+			fmt.Println("There is no txindex, scanning the chain. Start the node with -txindex to build it.")
+		}
+
+		block, position, err := bc.LocateTransaction(ID)
+		if err != nil {
+			log.Panic(err)
+		}
+		info = NewTxInfoJSON(bc, block, position)
+	}
+
+	txData, err := hex.DecodeString(info.Hex)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx := DeserializeTransaction(txData)
+
+	if info.BlockHash == "" {
+		fmt.Println("Unconfirmed, in the mempool")
+	} else {
+		fmt.Printf("Block: %s\n", info.BlockHash)
+		fmt.Printf("Height: %d\n", info.BlockHeight)
+		fmt.Printf("Position: %d\n", info.Position)
+		fmt.Printf("Confirmations: %d\n", info.Confirmations)
+	}
+	fmt.Println(&tx)
+}
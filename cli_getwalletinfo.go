@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) getWalletInfo(nodeID string) {
+	var info WalletInfoJSON
+	if cli.client != nil {
+		err := cli.client.Call("getwalletinfo", nil, &info)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		wallets, err := NewWallets(nodeID)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		var wtxs []WalletTransaction
+		if dbExists(fmt.Sprintf(dbFile, nodeID)) {
+			bc := NewBlockchain(nodeID)
+			defer bc.db.Close()
+			wtxs = bc.WalletTransactions()
+		}
+		info = NewWalletInfoJSON(wallets, wtxs)
+	}
+
+	fmt.Printf("Keys: %d, watch-only addresses: %d\n", info.Keys, info.WatchOnly)
+	fmt.Printf("HD: %t, encrypted: %t, locked: %t\n", info.HD, info.Encrypted, info.Locked)
+	fmt.Printf("Transactions: %d\n", info.TxCount)
+	fmt.Printf("Balance: %d, unconfirmed: %d\n", info.Balance, info.UnconfirmedBalance)
+	fmt.Printf("Watch-only balance: %d, unconfirmed: %d\n", info.WatchOnlyBalance, info.WatchOnlyUnconfirmedBalance)
+	if info.Scanning != nil {
+		fmt.Printf("Rescanning: block %d, %.0f%% in %d seconds\n", info.Scanning.Height, info.Scanning.Progress*100, info.Scanning.Duration)
+	}
+}
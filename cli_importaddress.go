@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// importAddress adds address to the wallet as watch-only, and finds its
+// transactions in the blockchain if rescan is set.
+func (cli *CLI) importAddress(address string, rescan bool, nodeID string) {
+	if cli.client != nil {
+		err := cli.client.Call("importaddress", []interface{}{address, rescan}, nil)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		// a wallet of watch-only addresses is fine
+		wallets, _ := NewWallets(nodeID)
+		err := wallets.ImportAddress(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallets.SaveToFile(nodeID)
+
+		if rescan {
+			rescanAfterImport(nodeID)
+		}
+	}
+
+	fmt.Printf("Watching %s\n", address)
+}
+
+// rescanAfterImport rescans the whole blockchain of the node for the
+// transactions of the imported addresses.
+func rescanAfterImport(nodeID string) {
+	bc := NewBlockchain(nodeID)
+	defer bc.db.Close()
+
+	_, err := bc.RescanWallet(0, -1, printRescanProgress())
+	if err != nil {
+		log.Panic(err)
+	}
+}
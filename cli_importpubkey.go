@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// importPubKey adds the address of the public key to the wallet as watch-only
+// as importAddress does.
+func (cli *CLI) importPubKey(pubKeyHex string, rescan bool, nodeID string) {
+	var address string
+	if cli.client != nil {
+		err := cli.client.Call("importpubkey", []interface{}{pubKeyHex, rescan}, &address)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		pubKey, err := hex.DecodeString(pubKeyHex)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		wallets, _ := NewWallets(nodeID)
+		address, err = wallets.ImportPubKey(pubKey)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallets.SaveToFile(nodeID)
+
+		if rescan {
+			rescanAfterImport(nodeID)
+		}
+	}
+
+	fmt.Printf("Watching %s\n", address)
+}
@@ -6,11 +6,20 @@ import (
 )
 
 func (cli *CLI) listAddresses(nodeID string) {
-	wallets, err := NewWallets(nodeID)
-	if err != nil {
-		log.Panic(err)
+	var addresses []string
+
+	if cli.client != nil {
+		err := cli.client.Call("listaddresses", nil, &addresses)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		wallets, err := NewWallets(nodeID)
+		if err != nil {
+			log.Panic(err)
+		}
+		addresses = wallets.GetAddresses()
 	}
-	addresses := wallets.GetAddresses()
 
 	for _, address := range addresses {
 		fmt.Println(address)
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// listTransactions prints count transactions of the wallet before the last
+// skip ones, the oldest first.
+func (cli *CLI) listTransactions(count, skip int, nodeID string) {
+	var wtxs []WalletTxJSON
+	if cli.client != nil {
+		err := cli.client.Call("listtransactions", []interface{}{count, skip}, &wtxs)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+
+		bestHeight, _ := bc.GetBestHeight()
+		wtxs = listWalletTransactions(bc.WalletTransactions(), count, skip, bestHeight)
+	}
+
+	for _, wtx := range wtxs {
+		watchOnly := ""
+		if wtx.WatchOnly {
+			watchOnly = " watch-only"
+		}
+		fmt.Printf("%s %-8s %+d fee %d, %d confirmations%s\n", wtx.TxID, wtx.Category, wtx.Amount, wtx.Fee, wtx.Confirmations, watchOnly)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// miner mines blocks for the node at node with templates fetched through gettemplate.
+func (cli *CLI) miner(node, address string, threads int) {
+	if !ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+
+	templates := make(chan *blocktemplate)
+	go pollTemplates(node, address, templates)
+
+	solved := make(chan *Block)
+	cancel := func() {}
+
+	for {
+		select {
+		case template := <-templates:
+			// the previous work is stale
+			cancel()
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			block := template.Block()
+
+			fmt.Printf("Mining block at height %d with %d transactions for %d coins\n", template.Height, len(block.Transactions), template.CoinbaseValue)
+			go func() {
+				if NewCPUMiner(threads).Solve(ctx, block) == nil {
+					solved <- block
+				}
+			}()
+
+		case block := <-solved:
+			result, err := requestSubmitBlock(node, block)
+			if err != nil {
+				fmt.Printf("Failed to submit block %x: %s\n", block.Hash, err)
+				continue
+			}
+
+			if result.Accepted {
+				fmt.Printf("Block %x is accepted!\n", block.Hash)
+			} else {
+				fmt.Printf("Block %x is rejected: %s\n", block.Hash, result.Reason)
+			}
+		}
+	}
+}
+
+// pollTemplates long-polls node and passes every new template to templates.
+func pollTemplates(node, address string, templates chan *blocktemplate) {
+	longPollID := ""
+
+	for {
+		template, err := requestBlockTemplate(node, address, longPollID)
+		if err != nil {
+			fmt.Printf("Failed to get a block template from %s: %s\n", node, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		if template.LongPollID != longPollID {
+			longPollID = template.LongPollID
+			templates <- template
+		}
+	}
+}
@@ -1,36 +1,26 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
+	"log"
 	"strconv"
 )
 
 func (cli *CLI) printChain(nodeID string) {
+	if cli.client != nil {
+		cli.printChainRPC()
+		return
+	}
+
 	bc := NewBlockchain(nodeID)
 	defer bc.db.Close()
 
 	bci := bc.Iterator()
 
-	/*
-		pow.block.PrevBlockHash,
-		pow.block.HashTransactions(),
-		IntToHex(pow.block.Timestamp),
-		IntToHex(int64(targetBits)),
-		IntToHex(int64(nonce))
-	*/
 	for {
 		block := bci.Next()
-		fmt.Printf("============= Block %x ============\n", block.Hash)
-		fmt.Printf("Height: %d\n", block.Height)
-		fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
-		fmt.Printf("Merkle Root: %x\n", block.HashTransactions())
-		fmt.Printf("Timestamp: %x\n", IntToHex(block.Timestamp))
-		fmt.Printf("Nonce: %x\n", IntToHex(int64(block.Nonce)))
-		pow := NewProofOfWork(block)
-		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
-		}
+		printBlock(block)
 
 		if len(block.PrevBlockHash) == 0 {
 			break
@@ -39,3 +29,48 @@ func (cli *CLI) printChain(nodeID string) {
 	}
 
 }
+
+// printChainRPC fetches the blocks one by one from the tip of the running node.
+func (cli *CLI) printChainRPC() {
+	var hash string
+	err := cli.client.Call("getbestblockhash", nil, &hash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for {
+		var blockHex string
+		err := cli.client.Call("getblock", []interface{}{hash, 0}, &blockHex)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		blockData, err := hex.DecodeString(blockHex)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		block := DeserializeBlock(blockData)
+		printBlock(block)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+		hash = hex.EncodeToString(block.PrevBlockHash)
+	}
+}
+
+// printBlock shows the header fields hashed by the pow and the transactions.
+func printBlock(block *Block) {
+	fmt.Printf("============= Block %x ============\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
+	fmt.Printf("Merkle Root: %x\n", block.HashTransactions())
+	fmt.Printf("Timestamp: %x\n", IntToHex(block.Timestamp))
+	fmt.Printf("Nonce: %x\n", IntToHex(int64(block.Nonce)))
+	pow := NewProofOfWork(block)
+	fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+}
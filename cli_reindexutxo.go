@@ -1,8 +1,22 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+)
 
 func (cli *CLI) reindexUTXO(nodeID string) {
+	if cli.client != nil {
+		var count int
+		err := cli.client.Call("reindexutxo", nil, &count)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+		return
+	}
+
 	bc := NewBlockchain(nodeID)
 	UTXOSet := UTXOSet{bc}
 	UTXOSet.Reindex()
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// rescanBlockchain rebuilds the wallet transactions of the blocks from to to,
+// the tip if to is negative. Without a node an interrupt aborts the rescan,
+// a node's rescan stops with abortrescan.
+func (cli *CLI) rescanBlockchain(from, to int, nodeID string) {
+	var result RescanJSON
+	if cli.client != nil {
+		params := []interface{}{from}
+		if to >= 0 {
+			params = append(params, to)
+		}
+		err := cli.client.Call("rescanblockchain", params, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		defer signal.Stop(sigs)
+		go func() {
+			for range sigs {
+				fmt.Println("Aborting the rescan...")
+				AbortRescan()
+			}
+		}()
+
+		scanned, err := bc.RescanWallet(from, to, printRescanProgress())
+		if err != nil && err != errRescanAborted {
+			log.Panic(err)
+		}
+		result = RescanJSON{from, scanned, err == errRescanAborted}
+	}
+
+	if result.Aborted {
+		fmt.Printf("Aborted! Rescanned blocks %d to %d, continue with -from %d\n", result.StartHeight, result.StopHeight, result.StopHeight+1)
+		return
+	}
+	fmt.Printf("Done! Rescanned blocks %d to %d\n", result.StartHeight, result.StopHeight)
+}
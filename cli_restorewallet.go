@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) restoreWallet(mnemonic, passphrase string, account uint32, gap int, nodeID string) {
+	var result RestoreWalletJSON
+
+	if cli.client != nil {
+		err := cli.client.Call("restorewallet", []interface{}{mnemonic, passphrase, account, gap}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		wallets, err := NewHDWallets(nodeID, mnemonic, passphrase, account)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		var used map[string]bool
+		if dbExists(fmt.Sprintf(dbFile, nodeID)) {
+			bc := NewBlockchain(nodeID)
+			used = usedPubKeyHashes(bc)
+			bc.db.Close()
+		}
+
+		result.Used = wallets.Recover(func(pubKeyHash []byte) bool {
+			return used[string(pubKeyHash)]
+		}, gap)
+		if len(wallets.Wallets) == 0 {
+			wallets.CreateWallet()
+		}
+		wallets.SaveToFile(nodeID)
+
+		result.Addresses = wallets.GetAddresses()
+	}
+
+	fmt.Printf("Restored %d used addresses\n", result.Used)
+	for _, address := range result.Addresses {
+		fmt.Println(address)
+	}
+}
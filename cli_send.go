@@ -5,7 +5,7 @@ import (
 	"log"
 )
 
-func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
+func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool, coinSelect string, feeRate float64) {
 	if !ValidateAddress(from) {
 		log.Panic("ERROR: Sender address is not valid")
 	}
@@ -13,24 +13,35 @@ func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
 		log.Panic("ERROR: Recipient address is not valid")
 	}
 
+	if cli.client != nil {
+		var txID string
+		err := cli.client.Call("sendtoaddress", []interface{}{from, to, amount, mineNow, coinSelect, feeRate}, &txID)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Success! Transaction %s\n", txID)
+		return
+	}
+
 	bc := NewBlockchain(nodeID)
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	wallets, err := NewWallets(nodeID)
+	wallets := loadUnlockedWallets(nodeID, "send")
+	wallet := wallets.GetWallet(from)
+
+	tx, selection, err := NewPaymentTransaction(&wallet, []TXOutput{*NewTXOutput(amount, to)}, &UTXOSet, coinSelect, feeRate)
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets.GetWallet(from)
-
-	tx := NewUTXOTransaction(&wallet, to, amount, &UTXOSet)
+	fmt.Printf("Spending %d coins of %s, fee %d, change %d\n", len(selection.Coins), from, selection.Fee, selection.Change)
 
 	if mineNow {
-		cbTx := NewCoinbaseTX(from, "")
-		txs := []*Transaction{cbTx, tx}
-
-		newBlock := bc.MineBlock(txs, &UTXOSet)
-		UTXOSet.Update(newBlock)
+		_, err := bc.MineTransactions([]*Transaction{tx}, from)
+		if err != nil {
+			log.Panic(err)
+		}
 	} else {
 		sendTx(fullNodes[0], tx)
 	}
@@ -38,3 +49,17 @@ func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
 	fmt.Println("Success!")
 
 }
+
+// loadUnlockedWallets loads the wallet of nodeID for action, send or sign,
+// which needs the keys of an unencrypted wallet.
+func loadUnlockedWallets(nodeID, action string) *Wallets {
+	wallets, err := NewWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if wallets.IsLocked() {
+		log.Panic("The wallet is encrypted, " + action + " through a running node unlocked with walletpassphrase!")
+	}
+
+	return wallets
+}
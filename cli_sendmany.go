@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+// sendMany pays the payments listed in file, JSON or CSV, in one transaction
+// and reports the total and the fee before it is relayed.
+func (cli *CLI) sendMany(from, file string, nodeID string, mineNow bool, coinSelect string, feeRate float64, dryRun bool) {
+	if !ValidateAddress(from) {
+		log.Panic("ERROR: Sender address is not valid")
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	payments, err := ParsePayments(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if cli.client != nil {
+		var result SendManyJSON
+		err := cli.client.Call("sendmany", []interface{}{from, payments, mineNow, coinSelect, feeRate, dryRun}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		printSendMany(result)
+		if dryRun {
+			fmt.Println(result.Hex)
+			return
+		}
+
+		fmt.Printf("Success! Transaction %s\n", result.TxID)
+		return
+	}
+
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	wallets := loadUnlockedWallets(nodeID, "send")
+	if wallets.Wallets[from] == nil {
+		log.Panic("ERROR: The wallet doesn't have the key of " + from)
+	}
+	wallet := wallets.GetWallet(from)
+
+	tx, selection, err := NewPaymentTransaction(&wallet, PaymentOutputs(payments), &UTXOSet, coinSelect, feeRate)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printSendMany(NewSendManyJSON(tx, selection, len(payments)))
+	if dryRun {
+		fmt.Println(hex.EncodeToString(tx.Serialize()))
+		return
+	}
+
+	if mineNow {
+		_, err := bc.MineTransactions([]*Transaction{tx}, from)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		sendTx(fullNodes[0], tx)
+	}
+
+	fmt.Printf("Success! Transaction %x\n", tx.ID)
+}
+
+func printSendMany(result SendManyJSON) {
+	fmt.Printf("Paying %d recipients a total of %d, fee %d, change %d\n", result.Recipients, result.Total, result.Fee, result.Change)
+}
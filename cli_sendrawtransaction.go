@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// sendRawTransaction relays a signed transaction to the running node, or to
+// the central node without one.
+func (cli *CLI) sendRawTransaction(txHex string) {
+	if cli.client != nil {
+		var txID string
+		err := cli.client.Call("sendrawtransaction", []interface{}{txHex}, &txID)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Success! Transaction %s\n", txID)
+		return
+	}
+
+	tx, err := DecodeRawTransaction(txHex)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !tx.Verify() {
+		log.Panic("ERROR: The transaction isn't signed completely")
+	}
+
+	sendTx(fullNodes[0], tx)
+
+	fmt.Printf("Success! Transaction %x\n", tx.ID)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) setMining(nodeID string, pause bool) {
+	if cli.client != nil {
+		err := cli.client.Call("setmining", []interface{}{pause}, nil)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		sendMining(fmt.Sprintf("localhost:%s", nodeID), pause)
+	}
+
+	fmt.Println("Success!")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// signPSBT signs the inputs with the wallet of nodeID, or with privKeys,
+// comma-separated hex keys, if they are given.
+func (cli *CLI) signPSBT(psbt, privKeys, nodeID string) {
+	keyList := splitPrivKeys(privKeys)
+
+	var result PSBTJSON
+	if cli.client != nil {
+		err := cli.client.Call("signpsbt", []interface{}{psbt, keyList}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		p, err := ParsePSBT(psbt)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		keys, wallets := loadSigningKeys(keyList, nodeID)
+		if wallets != nil {
+			keys.AddDerivations(wallets, p)
+		}
+
+		signed := p.Sign(keys)
+		result = PSBTJSON{p.Serialize(), signed, p.IsSigned()}
+	}
+
+	fmt.Println(result.PSBT)
+	fmt.Printf("Signed %d inputs\n", result.Signed)
+	printPSBTComplete(result.Complete)
+}
+
+func printPSBTComplete(complete bool) {
+	if complete {
+		fmt.Println("Complete")
+	} else {
+		fmt.Println("Incomplete, more signatures are needed")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// signRawTransaction signs the inputs of the transaction with the wallet of
+// the node, or with privKeys, comma-separated hex keys, if they are given.
+// prevTxs, a JSON array of txid/vout/address/amount, tells the outputs which
+// the inputs spend when there is no blockchain to look them up in.
+func (cli *CLI) signRawTransaction(txHex, prevTxs, privKeys, nodeID string) {
+	keyList := splitPrivKeys(privKeys)
+
+	var prevList json.RawMessage
+	if prevTxs != "" {
+		prevList = json.RawMessage(prevTxs)
+	}
+
+	var result SignRawJSON
+	if cli.client != nil {
+		err := cli.client.Call("signrawtransaction", []interface{}{txHex, prevList, keyList}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		result = signRawTransactionDirect(txHex, prevList, keyList, nodeID)
+	}
+
+	fmt.Println(result.Hex)
+	for _, e := range result.Errors {
+		fmt.Printf("Input %s:%d: %s\n", e.TxID, e.Vout, e.Error)
+	}
+	if result.Complete {
+		fmt.Println("Complete")
+	} else {
+		fmt.Println("Incomplete, more signatures are needed")
+	}
+}
+
+// splitPrivKeys splits the comma-separated hex keys of -privkeys.
+func splitPrivKeys(privKeys string) []string {
+	var keyList []string
+	if privKeys != "" {
+		for _, key := range strings.Split(privKeys, ",") {
+			keyList = append(keyList, strings.TrimSpace(key))
+		}
+	}
+
+	return keyList
+}
+
+// loadSigningKeys returns the keys of keyList or, without any, of the wallet
+// of nodeID, which it returns as well.
+func loadSigningKeys(keyList []string, nodeID string) (SigningKeys, *Wallets) {
+	keys := make(SigningKeys)
+	if len(keyList) > 0 {
+		for _, key := range keyList {
+			err := keys.AddPrivateKey(key)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+
+		return keys, nil
+	}
+
+	wallets := loadUnlockedWallets(nodeID, "sign")
+	keys.AddWallets(wallets)
+
+	return keys, wallets
+}
+
+// signRawTransactionDirect signs with the files of nodeID, neither of which
+// needs to exist when prevTxs and keyList are given.
+func signRawTransactionDirect(txHex string, prevTxs json.RawMessage, keyList []string, nodeID string) SignRawJSON {
+	tx, err := DecodeRawTransaction(txHex)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	prevOuts := make(map[string]TXOutput)
+	if prevTxs != nil {
+		prevOuts, err = ParsePrevOuts(prevTxs)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	keys, _ := loadSigningKeys(keyList, nodeID)
+
+	var view *UTXOView
+	if dbExists(fmt.Sprintf(dbFile, nodeID)) {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+		view = NewUTXOView(UTXOSet{bc})
+	}
+
+	complete, errs := SignRawTransaction(tx, prevOutLookup(prevOuts, view), keys)
+
+	return SignRawJSON{hex.EncodeToString(tx.Serialize()), complete, errs}
+}
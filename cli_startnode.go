@@ -5,7 +5,7 @@ import (
 	"log"
 )
 
-func (cli *CLI) startNode(nodeID, minerAddress string) {
+func (cli *CLI) startNode(nodeID, minerAddress string, rpc RPCConfig) {
 	fmt.Printf("Starting node %s\n", nodeID)
 	if len(minerAddress) > 0 {
 		if ValidateAddress(minerAddress) {
@@ -14,5 +14,29 @@ func (cli *CLI) startNode(nodeID, minerAddress string) {
 			log.Panic("Wrong miner address!")
 		}
 	}
+	if rpc.Port != "" {
+		if rpc.User == "" || rpc.Password == "" {
+			log.Panic("RPC needs -rpcuser and -rpcpassword!")
+		}
+		server := NewRPCServer(nodeID, rpc.User, rpc.Password)
+		if rpc.REST {
+			server.EnableREST()
+		}
+		if rpc.Explorer {
+			server.EnableExplorer()
+		}
+		if rpc.Metrics {
+			server.EnableMetrics()
+		}
+		server.Start(rpc.Port)
+	} else if rpc.REST || rpc.Explorer || rpc.Metrics {
+		log.Panic("REST, the explorer and the metrics need -rpcport!")
+	}
+
 	StartServer(nodeID, minerAddress)
 }
+
+func (cli *CLI) startSPVNode(nodeID string) {
+	fmt.Printf("Starting SPV node %s\n", nodeID)
+	StartSPVNode(nodeID)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// updatePSBT adds the previous outputs from the blockchain and the
+// derivations of the keys of the wallet of nodeID.
+func (cli *CLI) updatePSBT(psbt, nodeID string) {
+	if cli.client != nil {
+		var result string
+		err := cli.client.Call("updatepsbt", []interface{}{psbt}, &result)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println(result)
+		return
+	}
+
+	p, err := ParsePSBT(psbt)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var view *UTXOView
+	if dbExists(fmt.Sprintf(dbFile, nodeID)) {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+		view = NewUTXOView(UTXOSet{bc})
+	}
+
+	wallets, _ := NewWallets(nodeID)
+	p.Update(prevOutLookup(nil, view), wallets)
+
+	fmt.Println(p.Serialize())
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) walletLock() {
+	if cli.client == nil {
+		log.Panic("walletlock locks the wallet of a running node, set -rpcport!")
+	}
+
+	err := cli.client.Call("walletlock", nil, nil)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println("Wallet locked")
+}
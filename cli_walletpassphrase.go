@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// walletPassphrase unlocks the wallet of the running node, the keys stay in its memory only.
+func (cli *CLI) walletPassphrase(passphrase string, timeout int) {
+	if cli.client == nil {
+		log.Panic("walletpassphrase unlocks the wallet of a running node, set -rpcport!")
+	}
+
+	err := cli.client.Call("walletpassphrase", []interface{}{passphrase, timeout}, nil)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Wallet unlocked for %d seconds\n", timeout)
+}
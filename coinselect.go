@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// the strategy of a transaction when none is given: a changeless solution if
+// there is one, else a random draw
+const defaultCoinSelector = "auto"
+
+// how many branches branch-and-bound tries before it gives up
+const bnbMaxTries = 100000
+
+var errInsufficientFunds = errors.New("Not enough funds.")
+var errNoChangelessSolution = errors.New("There is no selection without change.")
+
+// Coin is an unspent output of a wallet.
+type Coin struct {
+	TxID  []byte
+	Vout  int
+	Value int
+}
+
+// CoinCosts are what the inputs and outputs of a transaction add to its fee.
+// The sizes are in bytes and FeeRate is in coins per 1000 bytes.
+type CoinCosts struct {
+	FeeRate float64
+	// the size of the transaction with the payments, but without inputs or change
+	BaseSize   int
+	InputSize  int
+	ChangeSize int
+}
+
+// Fee is what size bytes cost, rounded up.
+func (c CoinCosts) Fee(size int) int {
+	return int(math.Ceil(float64(size) * c.FeeRate / 1000))
+}
+
+// EffectiveValue is what coin adds to a transaction after paying for its input.
+func (c CoinCosts) EffectiveValue(coin Coin) int {
+	return coin.Value - c.Fee(c.InputSize)
+}
+
+// CostOfChange is what a change output costs now and when it is spent later.
+// Below it, an excess is better left to the fee.
+func (c CoinCosts) CostOfChange() int {
+	return c.Fee(c.ChangeSize) + c.Fee(c.InputSize)
+}
+
+// CoinSelection is the outcome of a strategy: the coins and how their value
+// splits into the target, the fee and the change, which is 0 without change.
+type CoinSelection struct {
+	Coins  []Coin
+	Value  int
+	Fee    int
+	Change int
+}
+
+// CoinSelector picks the coins which pay target plus the fee.
+type CoinSelector func(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error)
+
+var coinSelectors = map[string]CoinSelector{
+	"auto":     selectAuto,
+	"bnb":      selectBranchAndBound,
+	"largest":  selectLargestFirst,
+	"smallest": selectSmallestFirst,
+	"random":   selectRandom,
+}
+
+// CoinSelectorNames lists the strategies for usage messages.
+func CoinSelectorNames() string {
+	var names []string
+	for name := range coinSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// SelectCoins picks coins to pay target by the strategy called name.
+func SelectCoins(name string, coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	if name == "" {
+		name = defaultCoinSelector
+	}
+	selector, ok := coinSelectors[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown coin selection %s, use one of %s.", name, CoinSelectorNames())
+	}
+
+	// outputs which cost more to spend than they are worth are left alone
+	var economical []Coin
+	for _, coin := range coins {
+		if costs.EffectiveValue(coin) > 0 {
+			economical = append(economical, coin)
+		}
+	}
+
+	return selector(economical, target, costs)
+}
+
+// newCoinSelection sums up coins and decides whether the excess over target
+// and the fee is worth a change output.
+func newCoinSelection(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	selection := &CoinSelection{Coins: coins}
+	for _, coin := range coins {
+		selection.Value += coin.Value
+	}
+
+	size := costs.BaseSize + len(coins)*costs.InputSize
+	selection.Fee = costs.Fee(size)
+	if selection.Value < target+selection.Fee {
+		return nil, errInsufficientFunds
+	}
+
+	excess := selection.Value - target - selection.Fee
+	if excess > costs.CostOfChange() {
+		selection.Fee = costs.Fee(size + costs.ChangeSize)
+		selection.Change = selection.Value - target - selection.Fee
+	} else {
+		selection.Fee += excess
+	}
+
+	return selection, nil
+}
+
+// accumulate takes coins in order until their effective value pays target.
+func accumulate(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	need := target + costs.Fee(costs.BaseSize)
+	effective := 0
+
+	for i, coin := range coins {
+		effective += costs.EffectiveValue(coin)
+		if effective >= need {
+			return newCoinSelection(coins[:i+1], target, costs)
+		}
+	}
+
+	return nil, errInsufficientFunds
+}
+
+func sortCoins(coins []Coin, less func(a, b Coin) bool) []Coin {
+	sorted := append([]Coin{}, coins...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	return sorted
+}
+
+// selectLargestFirst spends the fewest coins.
+func selectLargestFirst(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	return accumulate(sortCoins(coins, func(a, b Coin) bool { return a.Value > b.Value }), target, costs)
+}
+
+// selectSmallestFirst consolidates small coins into the change, which is
+// best while fees are low.
+func selectSmallestFirst(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	return accumulate(sortCoins(coins, func(a, b Coin) bool { return a.Value < b.Value }), target, costs)
+}
+
+// selectRandom draws coins at random until they are enough, so that the
+// selection doesn't tell which outputs belong together.
+func selectRandom(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	shuffled := append([]Coin{}, coins...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return accumulate(shuffled, target, costs)
+}
+
+// selectAuto looks for a changeless solution first.
+func selectAuto(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	selection, err := selectBranchAndBound(coins, target, costs)
+	if err == nil {
+		return selection, nil
+	}
+
+	return selectRandom(coins, target, costs)
+}
+
+// selectBranchAndBound searches depth first for coins whose effective value
+// pays target and the fee with an excess below the cost of change, so that
+// the transaction needs no change output. Of those it returns the one with
+// the least excess, then the fewest coins.
+func selectBranchAndBound(coins []Coin, target int, costs CoinCosts) (*CoinSelection, error) {
+	sorted := sortCoins(coins, func(a, b Coin) bool { return a.Value > b.Value })
+
+	values := make([]int, len(sorted))
+	available := 0
+	for i, coin := range sorted {
+		values[i] = costs.EffectiveValue(coin)
+		available += values[i]
+	}
+
+	low := target + costs.Fee(costs.BaseSize)
+	high := low + costs.CostOfChange()
+	if available < low {
+		return nil, errInsufficientFunds
+	}
+
+	var best []bool
+	bestExcess, bestCount := 0, 0
+	selected := make([]bool, len(sorted))
+	tries := 0
+
+	// remaining is the effective value of the coins from index on
+	var search func(index, value, count, remaining int)
+	search = func(index, value, count, remaining int) {
+		tries++
+		if tries > bnbMaxTries || value > high || value+remaining < low {
+			return
+		}
+
+		if value >= low {
+			excess := value - low
+			if best == nil || excess < bestExcess || excess == bestExcess && count < bestCount {
+				best = append([]bool{}, selected...)
+				bestExcess, bestCount = excess, count
+			}
+			return
+		}
+		if index == len(sorted) {
+			return
+		}
+
+		remaining -= values[index]
+
+		// taking a coin equal to the one before which wasn't taken repeats that branch
+		if index == 0 || selected[index-1] || values[index] != values[index-1] {
+			selected[index] = true
+			search(index+1, value+values[index], count+1, remaining)
+			selected[index] = false
+		}
+
+		search(index+1, value, count, remaining)
+	}
+	search(0, 0, 0, available)
+
+	if best == nil {
+		return nil, errNoChangelessSolution
+	}
+
+	var chosen []Coin
+	for i, coin := range sorted {
+		if best[i] {
+			chosen = append(chosen, coin)
+		}
+	}
+
+	return newCoinSelection(chosen, target, costs)
+}
+
+// estimateCoinCosts measures the sizes of a transaction of wallet paying
+// outputs with signatures of the largest size.
+func estimateCoinCosts(wallet *Wallet, outputs []TXOutput, feeRate float64) CoinCosts {
+	signatureLen := 72
+	if wallet.IsSchnorr() {
+		signatureLen = 64
+	}
+	input := TXInput{bytes.Repeat([]byte{0xff}, 32), math.MaxInt32, make([]byte, signatureLen), wallet.PublicKey}
+	change := TXOutput{math.MaxInt32, HashPubKey(wallet.PublicKey)}
+
+	size := func(inputs int, withChange bool) int {
+		tx := Transaction{make([]byte, 32), nil, append([]TXOutput{}, outputs...)}
+		for i := 0; i < inputs; i++ {
+			tx.Vin = append(tx.Vin, input)
+		}
+		if withChange {
+			tx.Vout = append(tx.Vout, change)
+		}
+
+		return len(tx.Serialize())
+	}
+
+	costs := CoinCosts{FeeRate: feeRate}
+	costs.InputSize = size(2, false) - size(1, false)
+	costs.BaseSize = size(1, false) - costs.InputSize
+	costs.ChangeSize = size(1, true) - size(1, false)
+
+	return costs
+}
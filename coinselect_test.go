@@ -0,0 +1,227 @@
+package main
+
+import (
+	"testing"
+)
+
+func testCoins(values ...int) []Coin {
+	var coins []Coin
+	for i, value := range values {
+		coins = append(coins, Coin{[]byte{byte(i)}, i, value})
+	}
+
+	return coins
+}
+
+// checkCoinSelection tests that the coins of s add up to the target, the fee
+// and the change, and that the fee pays for the size of the transaction.
+func checkCoinSelection(t *testing.T, s *CoinSelection, target int, costs CoinCosts) {
+	t.Helper()
+
+	value := 0
+	for _, coin := range s.Coins {
+		value += coin.Value
+	}
+	if value != s.Value || s.Value != target+s.Fee+s.Change {
+		t.Fatalf("%d coins worth %d pay %d, a fee of %d and %d change", len(s.Coins), value, target, s.Fee, s.Change)
+	}
+
+	size := costs.BaseSize + len(s.Coins)*costs.InputSize
+	if s.Change > 0 {
+		size += costs.ChangeSize
+	}
+	if s.Fee < costs.Fee(size) {
+		t.Fatalf("a fee of %d for %d bytes", s.Fee, size)
+	}
+	if s.Change == 0 && s.Fee-costs.Fee(size) > costs.CostOfChange() {
+		t.Fatalf("an excess of %d went to the fee", s.Fee-costs.Fee(size))
+	}
+}
+
+func TestBranchAndBoundExactMatch(t *testing.T) {
+	// without fees the cost of change is 0, so only an exact match will do
+	var free CoinCosts
+
+	s, err := selectBranchAndBound(testCoins(3, 5, 7), 8, free)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Coins) != 2 || s.Value != 8 || s.Fee != 0 || s.Change != 0 {
+		t.Fatalf("%+v", s)
+	}
+
+	s, err = selectBranchAndBound(testCoins(3, 5, 7), 15, free)
+	if err != nil || len(s.Coins) != 3 || s.Change != 0 {
+		t.Fatal("missed the match of all coins", s, err)
+	}
+
+	// of the exact matches, the one with the fewest coins
+	s, err = selectBranchAndBound(testCoins(1, 2, 3, 4, 6), 6, free)
+	if err != nil || len(s.Coins) != 1 {
+		t.Fatal("more coins than needed", s, err)
+	}
+
+	_, err = selectBranchAndBound(testCoins(4, 4, 4), 7, free)
+	if err != errNoChangelessSolution {
+		t.Fatal(err)
+	}
+	_, err = selectBranchAndBound(testCoins(4, 4, 4), 13, free)
+	if err != errInsufficientFunds {
+		t.Fatal(err)
+	}
+}
+
+func TestBranchAndBoundEqualValues(t *testing.T) {
+	var free CoinCosts
+
+	// 42 is 10 of the 4s and the 2. With the 7 no subset of the 4s fits,
+	// which are far more than bnbMaxTries unless equal coins are skipped.
+	values := []int{7, 2}
+	for i := 0; i < 20; i++ {
+		values = append(values, 4)
+	}
+
+	s, err := selectBranchAndBound(testCoins(values...), 42, free)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Coins) != 11 || s.Value != 42 || s.Change != 0 {
+		t.Fatalf("%d coins worth %d", len(s.Coins), s.Value)
+	}
+	for _, coin := range s.Coins {
+		if coin.Value == 7 {
+			t.Fatal("spent the 7")
+		}
+	}
+}
+
+func TestBranchAndBoundMaxTries(t *testing.T) {
+	var free CoinCosts
+
+	// 400 is made of the even coins, but with the 101 first the search
+	// runs through the subsets of the even coins and gives up.
+	values := []int{101}
+	for value := 2; value <= 60; value += 2 {
+		values = append(values, value)
+	}
+
+	_, err := selectBranchAndBound(testCoins(values...), 400, free)
+	if err != errNoChangelessSolution {
+		t.Fatal(err)
+	}
+
+	s, err := selectBranchAndBound(testCoins(values[1:]...), 400, free)
+	if err != nil || s.Value != 400 {
+		t.Fatal("no match without the 101", s, err)
+	}
+}
+
+func TestCoinSelectionFees(t *testing.T) {
+	// a coin per 100 bytes: an input costs 2, the change 1, the base 1
+	costs := CoinCosts{FeeRate: 10, BaseSize: 100, InputSize: 150, ChangeSize: 50}
+	if costs.EffectiveValue(Coin{Value: 12}) != 10 || costs.CostOfChange() != 3 {
+		t.Fatal(costs.EffectiveValue(Coin{Value: 12}), costs.CostOfChange())
+	}
+
+	coins := testCoins(12, 7, 30, 45, 9, 21)
+	for _, target := range []int{5, 14, 20, 50, 100, 110} {
+		for name := range coinSelectors {
+			s, err := SelectCoins(name, coins, target, costs)
+			if err == errNoChangelessSolution {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s of %d: %s", name, target, err)
+			}
+			checkCoinSelection(t, s, target, costs)
+		}
+	}
+
+	// 14 and the base fee of 1 are the effective values 10 and 5, the 1 is
+	// worth less than its input
+	s, err := SelectCoins("bnb", testCoins(12, 7, 1), 14, costs)
+	if err != nil || len(s.Coins) != 2 || s.Fee != 5 || s.Change != 0 {
+		t.Fatal(s, err)
+	}
+
+	// an excess of 2 is below the cost of change and goes to the fee
+	s, err = selectBranchAndBound(testCoins(12, 7), 13, costs)
+	if err != nil || s.Fee != 6 || s.Change != 0 {
+		t.Fatal(s, err)
+	}
+
+	// an excess of 24 pays for the change output
+	s, err = newCoinSelection(testCoins(30), 3, costs)
+	if err != nil || s.Fee != 3 || s.Change != 24 {
+		t.Fatal(s, err)
+	}
+
+	_, err = newCoinSelection(testCoins(30), 28, costs)
+	if err != errInsufficientFunds {
+		t.Fatal(err)
+	}
+}
+
+func TestCoinSelectionUneconomical(t *testing.T) {
+	costs := CoinCosts{FeeRate: 10, BaseSize: 100, InputSize: 150, ChangeSize: 50}
+
+	// the 1s and 2s cost as much to spend as they are worth
+	coins := testCoins(1, 2, 20, 1, 2, 15, 2, 1)
+	for name := range coinSelectors {
+		for _, target := range []int{5, 18, 30} {
+			s, err := SelectCoins(name, coins, target, costs)
+			if err == errNoChangelessSolution {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s of %d: %s", name, target, err)
+			}
+			for _, coin := range s.Coins {
+				if costs.EffectiveValue(coin) <= 0 {
+					t.Fatalf("%s spent a coin of %d", name, coin.Value)
+				}
+			}
+			checkCoinSelection(t, s, target, costs)
+		}
+
+		// 20 and 15 pay at most 30 after their inputs and the base
+		_, err := SelectCoins(name, coins, 31, costs)
+		if err != errInsufficientFunds && err != errNoChangelessSolution {
+			t.Fatalf("%s: %v", name, err)
+		}
+		_, err = SelectCoins(name, testCoins(1, 2, 2, 1), 1, costs)
+		if err != errInsufficientFunds {
+			t.Fatalf("%s spent uneconomical coins: %v", name, err)
+		}
+	}
+
+	if _, err := SelectCoins("other", coins, 1, costs); err == nil {
+		t.Fatal("selected with an unknown strategy")
+	}
+}
+
+func TestCoinSelectionAuto(t *testing.T) {
+	var free CoinCosts
+	coins := testCoins(4, 4, 4, 4)
+
+	s, err := SelectCoins("", coins, 8, free)
+	if err != nil || len(s.Coins) != 2 || s.Change != 0 {
+		t.Fatal("auto missed the changeless solution", s, err)
+	}
+
+	// no subset of the 4s makes 7, so random pays it with change
+	_, err = SelectCoins("bnb", coins, 7, free)
+	if err != errNoChangelessSolution {
+		t.Fatal(err)
+	}
+	s, err = SelectCoins("auto", coins, 7, free)
+	if err != nil || len(s.Coins) != 2 || s.Change != 1 {
+		t.Fatal("auto didn't fall back to random", s, err)
+	}
+	checkCoinSelection(t, s, 7, free)
+
+	_, err = SelectCoins("auto", coins, 17, free)
+	if err != errInsufficientFunds {
+		t.Fatal(err)
+	}
+}
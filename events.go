@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the event types sent to subscribers
+const (
+	eventBlockConnected = "blockconnected"
+	eventTxAccepted     = "txaccepted"
+	eventTxRemoved      = "txremoved"
+	eventAddressTx      = "addresstx"
+)
+
+// the reasons of txremoved events
+const (
+	removeReasonBlock    = "block"
+	removeReasonRejected = "rejected"
+)
+
+// a subscriber which doesn't keep up with this many events is dropped
+const eventBufferSize = 256
+
+// a comment is sent after this long without events to keep the connection open
+var eventKeepAliveInterval = 30 * time.Second
+
+// Event is a change of the chain or the mempool. Only the fields of its type are set.
+type Event struct {
+	Type      string `json:"type"`
+	Hash      string `json:"hash,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	TxID      string `json:"txid,omitempty"`
+	Txs       int    `json:"txs,omitempty"`
+	Fee       int    `json:"fee,omitempty"`
+	Size      int    `json:"size,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Address   string `json:"address,omitempty"`
+	BlockHash string `json:"blockhash,omitempty"`
+
+	// the addresses of a transaction, used to find the addresstx subscribers
+	addresses []string
+}
+
+type eventSubscriber struct {
+	events chan Event
+	// nil receives all types
+	types map[string]bool
+	// receives addresstx events for these
+	addresses map[string]bool
+}
+
+// EventHub fans the events out to the subscribers without blocking the publisher.
+type EventHub struct {
+	lock        sync.Mutex
+	subscribers map[*eventSubscriber]bool
+}
+
+var events = &EventHub{subscribers: make(map[*eventSubscriber]bool)}
+
+// Subscribe registers a subscriber for types (all if empty) and the addresstx
+// events of addresses. The channel is closed by Unsubscribe or when the
+// subscriber falls behind.
+func (h *EventHub) Subscribe(types, addresses []string) *eventSubscriber {
+	s := &eventSubscriber{events: make(chan Event, eventBufferSize), addresses: make(map[string]bool)}
+	if len(types) > 0 {
+		s.types = make(map[string]bool)
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	for _, address := range addresses {
+		s.addresses[address] = true
+	}
+
+	h.lock.Lock()
+	h.subscribers[s] = true
+	h.lock.Unlock()
+
+	return s
+}
+
+func (h *EventHub) Unsubscribe(s *eventSubscriber) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Publish sends event to the subscribers of its type, and an addresstx
+// event to the subscribers of each address it touches. An addresstx event
+// itself only carries the addresses of a confirmed transaction.
+func (h *EventHub) Publish(event Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for s := range h.subscribers {
+		if event.Type != eventAddressTx && (s.types == nil || s.types[event.Type]) {
+			h.send(s, event)
+		}
+
+		if s.types != nil && !s.types[eventAddressTx] {
+			continue
+		}
+		for _, address := range event.addresses {
+			if s.addresses[address] {
+				h.send(s, Event{Type: eventAddressTx, TxID: event.TxID, Address: address, BlockHash: event.BlockHash, Height: event.Height})
+			}
+		}
+	}
+}
+
+// send must be called with h.lock held.
+func (h *EventHub) send(s *eventSubscriber, event Event) {
+	select {
+	case s.events <- event:
+	default:
+		fmt.Println("Drop an event subscriber which falls behind")
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// txAddresses returns the addresses which tx spends from or pays to.
+func txAddresses(tx *Transaction) []string {
+	seen := make(map[string]bool)
+	var addresses []string
+
+	add := func(pubKeyHash []byte) {
+		address := PubKeyHashToAddress(pubKeyHash)
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			add(HashPubKey(vin.PubKey))
+		}
+	}
+	for _, out := range tx.Vout {
+		add(out.PubKeyHash)
+	}
+
+	return addresses
+}
+
+func publishBlockConnected(block *Block) {
+	blockHash := hex.EncodeToString(block.Hash)
+	events.Publish(Event{Type: eventBlockConnected, Hash: blockHash, Height: block.Height, Txs: len(block.Transactions)})
+
+	for _, tx := range block.Transactions {
+		events.Publish(Event{Type: eventAddressTx, TxID: hex.EncodeToString(tx.ID), BlockHash: blockHash, Height: block.Height, addresses: txAddresses(tx)})
+	}
+}
+
+func publishTxAccepted(tx *Transaction, fee int) {
+	events.Publish(Event{Type: eventTxAccepted, TxID: hex.EncodeToString(tx.ID), Fee: fee, Size: len(tx.Serialize()), addresses: txAddresses(tx)})
+}
+
+func publishTxRemoved(tx *Transaction, reason string) {
+	events.Publish(Event{Type: eventTxRemoved, TxID: hex.EncodeToString(tx.ID), Reason: reason})
+}
+
+// handleEvents streams the events as server-sent events:
+//
+//	GET /events?types=blockconnected,txaccepted&address=ADDRESS&address=...
+//
+// Without types all events are sent. addresstx events are only sent for
+// the given addresses, for transactions entering the mempool and the chain.
+func (s *RPCServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	var types []string
+	if query.Get("types") != "" {
+		types = strings.Split(query.Get("types"), ",")
+	}
+	for _, address := range query["address"] {
+		if !ValidateAddress(address) {
+			http.Error(w, "Invalid address: "+address, http.StatusBadRequest)
+			return
+		}
+	}
+
+	subscriber := events.Subscribe(types, query["address"])
+	defer events.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscriber.events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Printf("Failed to encode event: %s\n", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the home page of the explorer shows this many blocks
+const explorerRecentBlocks = 20
+
+var explorerTemplates = template.Must(template.New("explorer").Funcs(template.FuncMap{
+	"time": func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}} - Blockchain Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 70em; color: #222; }
+a { color: #0a58ca; text-decoration: none; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #ddd; }
+td.hash { font-family: monospace; word-break: break-all; }
+form { margin-bottom: 1.5em; }
+input[type=text] { width: 40em; }
+.tx { border: 1px solid #ddd; padding: 0.5em 1em; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1><a href="/explorer/">Blockchain Explorer</a></h1>
+<form action="/explorer/search">
+<input type="text" name="q" placeholder="Block hash or height, txid or address">
+<input type="submit" value="Search">
+</form>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "outputs"}}<table>
+<tr><th>#</th><th>Address</th><th>Value</th>{{if .Status}}<th>Status</th>{{end}}</tr>
+{{range .Vout}}<tr id="out{{.N}}"><td>{{.N}}</td><td class="hash"><a href="/explorer/address/{{.Address}}">{{.Address}}</a></td><td>{{.Value}}</td>{{if $.Status}}<td>{{index $.Status .N}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+
+{{define "home"}}{{template "header" "Home"}}
+<h2>Recent blocks</h2>
+<p>Height {{.Height}}, {{len .Mempool}} unconfirmed transactions.</p>
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th>Transactions</th><th>Size</th></tr>
+{{range .Blocks}}<tr><td>{{.Height}}</td><td class="hash"><a href="/explorer/block/{{.Hash}}">{{.Hash}}</a></td><td>{{time .Time}}</td><td>{{len .Tx}}</td><td>{{.Size}}</td></tr>
+{{end}}</table>
+{{if .Mempool}}<h2>Unconfirmed transactions</h2>
+<table>
+<tr><th>Txid</th><th>Size</th></tr>
+{{range .Mempool}}<tr><td class="hash"><a href="/explorer/tx/{{.TxID}}">{{.TxID}}</a></td><td>{{.Size}}</td></tr>
+{{end}}</table>
+{{end}}{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header" "Block"}}
+<h2>Block {{.Height}}</h2>
+<table>
+<tr><th>Hash</th><td class="hash">{{.Hash}}</td></tr>
+<tr><th>Previous block</th><td class="hash">{{if .PreviousBlockHash}}<a href="/explorer/block/{{.PreviousBlockHash}}">{{.PreviousBlockHash}}</a>{{end}}</td></tr>
+<tr><th>Merkle root</th><td class="hash">{{.MerkleRoot}}</td></tr>
+<tr><th>Time</th><td>{{time .Time}}</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+<tr><th>Confirmations</th><td>{{.Confirmations}}</td></tr>
+</table>
+<h2>Transactions</h2>
+{{range .Tx}}<div class="tx">
+<p>Txid <a class="hash" href="/explorer/tx/{{.TxID}}">{{.TxID}}</a></p>
+<table>
+<tr><th>Input</th><th>Spends</th></tr>
+{{range .Vin}}<tr>{{if .Coinbase}}<td>coinbase</td><td class="hash">{{.Coinbase}}</td>{{else}}<td></td><td class="hash"><a href="/explorer/tx/{{.TxID}}#out{{.Vout}}">{{.TxID}}:{{.Vout}}</a></td>{{end}}</tr>
+{{end}}</table>
+{{template "outputs" .}}</div>
+{{end}}{{template "footer"}}{{end}}
+
+{{define "tx"}}{{template "header" "Transaction"}}
+<h2>Transaction</h2>
+<table>
+<tr><th>Txid</th><td class="hash">{{.TxID}}</td></tr>
+<tr><th>Block</th><td class="hash">{{if .BlockHash}}<a href="/explorer/block/{{.BlockHash}}">{{.BlockHash}}</a> ({{.Confirmations}} confirmations){{else}}unconfirmed{{end}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+<tr><th>Fee</th><td>{{.Fee}}</td></tr>
+</table>
+<h2>Inputs</h2>
+<table>
+<tr><th>Source output</th><th>Address</th><th>Value</th></tr>
+{{range .Inputs}}<tr>{{if .Coinbase}}<td class="hash">coinbase {{.Coinbase}}</td><td></td><td></td>{{else}}<td class="hash"><a href="/explorer/tx/{{.TxID}}#out{{.Vout}}">{{.TxID}}:{{.Vout}}</a></td><td class="hash"><a href="/explorer/address/{{.Address}}">{{.Address}}</a></td><td>{{.Value}}</td>{{end}}</tr>
+{{end}}</table>
+<h2>Outputs</h2>
+{{template "outputs" .}}{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header" "Address"}}
+<h2>Address</h2>
+<table>
+<tr><th>Address</th><td class="hash">{{.Address}}</td></tr>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+<tr><th>Transactions</th><td>{{len .History}}</td></tr>
+</table>
+<h2>History</h2>
+<table>
+<tr><th>Height</th><th>Txid</th><th>Received</th><th>Sent</th></tr>
+{{range .History}}<tr><td>{{if ge .Height 0}}{{.Height}}{{else}}unconfirmed{{end}}</td><td class="hash"><a href="/explorer/tx/{{.TxID}}">{{.TxID}}</a></td><td>{{.Received}}</td><td>{{.Sent}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "notfound"}}{{template "header" "Not found"}}
+<h2>Not found</h2>
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+`))
+
+type explorerHome struct {
+	Height  int
+	Blocks  []BlockJSON
+	Mempool []TxJSON
+}
+
+type explorerBlock struct {
+	BlockJSON
+	Tx []explorerTx
+}
+
+type explorerInput struct {
+	TxID     string
+	Vout     int
+	Coinbase string
+	Address  string
+	Value    int
+}
+
+type explorerTx struct {
+	TxJSON
+	Fee    int
+	Inputs []explorerInput
+	// spent or unspent for each output of a confirmed transaction
+	Status []string
+}
+
+type explorerHistoryEntry struct {
+	TxID string
+	// -1 for transactions in the mempool
+	Height   int
+	Received int
+	Sent     int
+}
+
+type explorerAddress struct {
+	Address string
+	Balance int
+	History []explorerHistoryEntry
+}
+
+// EnableExplorer serves a block explorer under /explorer/ without authentication.
+func (s *RPCServer) EnableExplorer() {
+	s.Mux.HandleFunc("/explorer/", handleExplorer)
+	fmt.Println("Block explorer is enabled")
+}
+
+func handleExplorer(w http.ResponseWriter, r *http.Request) {
+	bc := getLocalChain()
+	if bc == nil {
+		http.Error(w, "the node doesn't have a blockchain yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/explorer/"), "/")
+	parts := strings.SplitN(path, "/", 2)
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	switch parts[0] {
+	case "":
+		explorerRender(w, "home", explorerHomePage(bc))
+	case "block":
+		explorerBlockPage(w, bc, arg)
+	case "tx":
+		explorerTxPage(w, bc, arg)
+	case "address":
+		explorerAddressPage(w, bc, arg)
+	case "search":
+		explorerSearch(w, r, bc)
+	default:
+		explorerNotFound(w, "Unknown page "+r.URL.Path)
+	}
+}
+
+func explorerRender(w http.ResponseWriter, name string, data interface{}) {
+	explorerWrite(w, http.StatusOK, name, data)
+}
+
+func explorerNotFound(w http.ResponseWriter, message string) {
+	explorerWrite(w, http.StatusNotFound, "notfound", message)
+}
+
+func explorerWrite(w http.ResponseWriter, status int, name string, data interface{}) {
+	var page bytes.Buffer
+	err := explorerTemplates.ExecuteTemplate(&page, name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page.Bytes())
+}
+
+func explorerHomePage(bc *Blockchain) explorerHome {
+	height, _ := bc.GetBestHeight()
+	home := explorerHome{Height: height}
+
+	bci := bc.Iterator()
+	for len(home.Blocks) < explorerRecentBlocks {
+		block := bci.Next()
+		home.Blocks = append(home.Blocks, NewBlockJSON(block, height, false))
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	for _, tx := range mempoolTransactions() {
+		home.Mempool = append(home.Mempool, NewTxJSON(tx))
+	}
+
+	return home
+}
+
+func explorerBlockPage(w http.ResponseWriter, bc *Blockchain, hash string) {
+	blockHash, err := hex.DecodeString(hash)
+	if err != nil {
+		explorerNotFound(w, "Invalid block hash "+hash)
+		return
+	}
+
+	block, err := bc.GetBlock(blockHash)
+	if err != nil {
+		explorerNotFound(w, "Block "+hash+" is not found")
+		return
+	}
+
+	height, _ := bc.GetBestHeight()
+	page := explorerBlock{BlockJSON: NewBlockJSON(&block, height, false)}
+	for _, tx := range block.Transactions {
+		page.Tx = append(page.Tx, explorerTx{TxJSON: NewTxJSON(tx)})
+	}
+
+	explorerRender(w, "block", page)
+}
+
+func explorerTxPage(w http.ResponseWriter, bc *Blockchain, txID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		explorerNotFound(w, "Invalid txid "+txID)
+		return
+	}
+
+	var page explorerTx
+	tx, inMempool := mempoolTransaction(txID)
+	if inMempool {
+		page.TxJSON = NewTxJSON(&tx)
+	} else {
+		block, position, err := bc.LocateTransaction(ID)
+		if err != nil {
+			explorerNotFound(w, "Transaction "+txID+" is not found")
+			return
+		}
+
+		tx = *block.Transactions[position]
+		height, _ := bc.GetBestHeight()
+		page.TxJSON = NewTxJSON(&tx)
+		page.BlockHash = hex.EncodeToString(block.Hash)
+		page.Confirmations = height - block.Height + 1
+
+		view := NewUTXOView(UTXOSet{bc})
+		for i := range tx.Vout {
+			if _, ok := view.FetchOutput(tx.ID, i); ok {
+				page.Status = append(page.Status, "unspent")
+			} else {
+				page.Status = append(page.Status, "spent")
+			}
+		}
+	}
+
+	inputValue := 0
+	for _, vin := range page.Vin {
+		if vin.Coinbase != "" {
+			page.Inputs = append(page.Inputs, explorerInput{Coinbase: vin.Coinbase})
+			continue
+		}
+
+		input := explorerInput{TxID: vin.TxID, Vout: vin.Vout}
+		source, ok := mempoolTransaction(vin.TxID)
+		if !ok {
+			sourceID, _ := hex.DecodeString(vin.TxID)
+			source, err = bc.FindTransaction(sourceID)
+			ok = err == nil
+		}
+		if ok && vin.Vout >= 0 && vin.Vout < len(source.Vout) {
+			out := source.Vout[vin.Vout]
+			input.Address = PubKeyHashToAddress(out.PubKeyHash)
+			input.Value = out.Value
+			inputValue += out.Value
+		}
+		page.Inputs = append(page.Inputs, input)
+	}
+
+	if !tx.IsCoinbase() {
+		page.Fee = inputValue - tx.OutputValue()
+	}
+
+	explorerRender(w, "tx", page)
+}
+
+func explorerAddressPage(w http.ResponseWriter, bc *Blockchain, address string) {
+	if !ValidateAddress(address) {
+		explorerNotFound(w, "Invalid address "+address)
+		return
+	}
+
+	pubKeyHash := AddressToPubKeyHash(address)
+	page := explorerAddress{Address: address, Balance: bc.AddressBalance(pubKeyHash), History: addressHistory(bc, pubKeyHash)}
+	explorerRender(w, "address", page)
+}
+
+func explorerSearch(w http.ResponseWriter, r *http.Request, bc *Blockchain) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if height, err := strconv.Atoi(query); err == nil {
+		if hash, err := bc.GetBlockHashByHeight(height); err == nil {
+			http.Redirect(w, r, "/explorer/block/"+hex.EncodeToString(hash), http.StatusFound)
+			return
+		}
+	}
+
+	if ID, err := hex.DecodeString(query); err == nil && len(ID) > 0 {
+		if _, err := bc.GetBlock(ID); err == nil {
+			http.Redirect(w, r, "/explorer/block/"+query, http.StatusFound)
+			return
+		}
+		if _, ok := mempoolTransaction(query); ok {
+			http.Redirect(w, r, "/explorer/tx/"+query, http.StatusFound)
+			return
+		}
+		if _, _, err := bc.LocateTransaction(ID); err == nil {
+			http.Redirect(w, r, "/explorer/tx/"+query, http.StatusFound)
+			return
+		}
+	}
+
+	if ValidateAddress(query) {
+		http.Redirect(w, r, "/explorer/address/"+query, http.StatusFound)
+		return
+	}
+
+	explorerNotFound(w, "Nothing matches "+query)
+}
+
+// addressHistory lists the transactions paying to or spending from pubKeyHash,
+// the unconfirmed ones first and then the newest blocks first.
+func addressHistory(bc *Blockchain, pubKeyHash []byte) []explorerHistoryEntry {
+	// the outputs received by the address, to get the value of its spendings
+	received := make(map[string]int)
+	var history []explorerHistoryEntry
+
+	addTx := func(tx *Transaction, height int) {
+		entry := explorerHistoryEntry{TxID: hex.EncodeToString(tx.ID), Height: height}
+
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				if vin.UseKey(pubKeyHash) {
+					entry.Sent += received[outpointKey(vin.Txid, vin.Vout)]
+				}
+			}
+		}
+		for i, out := range tx.Vout {
+			if out.IsLockedWithKey(pubKeyHash) {
+				received[outpointKey(tx.ID, i)] = out.Value
+				entry.Received += out.Value
+			}
+		}
+
+		if entry.Sent > 0 || entry.Received > 0 {
+			history = append(history, entry)
+		}
+	}
+
+	if events, err := bc.AddressHistory(pubKeyHash); err == nil {
+		entries := make(map[string]int)
+		for _, e := range events {
+			txID := hex.EncodeToString(e.TxID)
+			if _, ok := entries[txID]; !ok {
+				entries[txID] = len(history)
+				history = append(history, explorerHistoryEntry{TxID: txID, Height: e.Height})
+			}
+
+			if e.Spending {
+				history[entries[txID]].Sent += e.Value
+			} else {
+				history[entries[txID]].Received += e.Value
+				received[outpointKey(e.TxID, e.Index)] = e.Value
+			}
+		}
+	} else {
+		hashes := bc.GetBlockHashes()
+		for i := len(hashes) - 1; i >= 0; i-- {
+			block, err := bc.GetBlock(hashes[i])
+			if err != nil {
+				continue
+			}
+			for _, tx := range block.Transactions {
+				addTx(tx, block.Height)
+			}
+		}
+	}
+
+	// unconfirmed transactions may spend each other in any order
+	unconfirmed := mempoolTransactions()
+	for _, tx := range unconfirmed {
+		for i, out := range tx.Vout {
+			if out.IsLockedWithKey(pubKeyHash) {
+				received[outpointKey(tx.ID, i)] = out.Value
+			}
+		}
+	}
+	for _, tx := range unconfirmed {
+		addTx(tx, -1)
+	}
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return history
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// Golomb-coded set parameters of the block filters, as in BIP 158
+const (
+	gcsP = 19
+	gcsM = 784931
+)
+
+// GCSFilter is a Golomb-coded set: a compact probabilistic set which may
+// report false positives at a rate of 1/M, but no false negatives.
+type GCSFilter struct {
+	N    uint32
+	P    uint8
+	M    uint64
+	Data []byte
+}
+
+// NewGCSFilter builds the set of items, hashed with the 16 byte key. N
+// counts the distinct items, as many as there are deltas.
+func NewGCSFilter(key [16]byte, items [][]byte, P uint8, M uint64) *GCSFilter {
+	var unique [][]byte
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if !seen[string(item)] {
+			seen[string(item)] = true
+			unique = append(unique, item)
+		}
+	}
+
+	// items whose hashes collide are kept as a delta of 0
+	values := hashedSetValues(key, unique, uint64(len(unique))*M)
+
+	var w bitWriter
+	var last uint64
+	for _, value := range values {
+		delta := value - last
+		last = value
+
+		// the quotient in unary, the remainder in P bits
+		for q := delta >> P; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		w.writeBits(delta, P)
+	}
+
+	return &GCSFilter{N: uint32(len(unique)), P: P, M: M, Data: w.bytes}
+}
+
+// ParseGCSFilter reads a filter serialized by Bytes.
+func ParseGCSFilter(data []byte, P uint8, M uint64) (*GCSFilter, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > 1<<32-1 {
+		return nil, errors.New("Invalid filter size.")
+	}
+
+	return &GCSFilter{N: uint32(n), P: P, M: M, Data: data[size:]}, nil
+}
+
+// Bytes serializes the number of items followed by the Golomb-Rice coded deltas.
+func (f *GCSFilter) Bytes() []byte {
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(f.N))
+
+	return append(size[:n], f.Data...)
+}
+
+// Match reports whether item is probably in the set.
+func (f *GCSFilter) Match(key [16]byte, item []byte) bool {
+	return f.MatchAny(key, [][]byte{item})
+}
+
+// MatchAny reports whether any of items is probably in the set.
+func (f *GCSFilter) MatchAny(key [16]byte, items [][]byte) bool {
+	if f.N == 0 || len(items) == 0 {
+		return false
+	}
+
+	queries := hashedSetValues(key, items, uint64(f.N)*f.M)
+	r := bitReader{data: f.Data}
+	var value uint64
+
+	// both lists are sorted, so they are merged in one pass
+	for i := uint32(0); i < f.N; i++ {
+		delta, ok := r.readGolombRice(f.P)
+		if !ok {
+			return false
+		}
+		value += delta
+
+		for len(queries) > 0 && queries[0] < value {
+			queries = queries[1:]
+		}
+		if len(queries) == 0 {
+			return false
+		}
+		if queries[0] == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hashedSetValues maps items uniformly to [0, F) and sorts them.
+func hashedSetValues(key [16]byte, items [][]byte, F uint64) []uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	var values []uint64
+	for _, item := range items {
+		value, _ := bits.Mul64(sipHash24(k0, k1, item), F)
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	return values
+}
+
+type bitWriter struct {
+	bytes []byte
+	used  uint8
+}
+
+func (w *bitWriter) writeBit(bit uint64) {
+	if w.used == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.used = 8
+	}
+	w.used--
+	w.bytes[len(w.bytes)-1] |= byte(bit&1) << w.used
+}
+
+// writeBits writes the n low bits of value, the most significant first.
+func (w *bitWriter) writeBits(value uint64, n uint8) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.writeBit(value >> uint(i))
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) readBit() (uint64, bool) {
+	if r.pos >= len(r.data)*8 {
+		return 0, false
+	}
+	bit := r.data[r.pos/8] >> uint(7-r.pos%8) & 1
+	r.pos++
+
+	return uint64(bit), true
+}
+
+func (r *bitReader) readGolombRice(P uint8) (uint64, bool) {
+	var q uint64
+	for {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		if bit == 0 {
+			break
+		}
+		q++
+	}
+
+	remainder := uint64(0)
+	for i := uint8(0); i < P; i++ {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		remainder = remainder<<1 | bit
+	}
+
+	return q<<P | remainder, true
+}
+
+// sipHash24 is SipHash-2-4 of data with the key k0, k1.
+func sipHash24(k0, k1 uint64, data []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	length := len(data)
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	// the last block holds the remaining bytes and the length
+	var last [8]byte
+	copy(last[:], data)
+	last[7] = byte(length)
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
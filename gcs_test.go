@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestSipHash24(t *testing.T) {
+	// the vectors of the SipHash paper: the key 00 01 .. 0f and the messages
+	// 00 01 .. of every length, the hashes as little-endian bytes
+	vectors := map[int]string{
+		0:  "310e0edd47db6f72",
+		1:  "fd67dc93c539f874",
+		2:  "5a4fa9d909806c0d",
+		3:  "2d7efbd796666785",
+		7:  "37d1018bf50002ab",
+		8:  "6224939a79f5f593",
+		15: "e545be4961ca29a1",
+		16: "db9bc2577fcc2a3f",
+		63: "724506eb4c328a95",
+	}
+
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	for length, want := range vectors {
+		message := make([]byte, length)
+		for i := range message {
+			message[i] = byte(i)
+		}
+
+		var got [8]byte
+		binary.LittleEndian.PutUint64(got[:], sipHash24(k0, k1, message))
+		if hex.EncodeToString(got[:]) != want {
+			t.Fatalf("length %d: %x, want %s", length, got, want)
+		}
+	}
+}
+
+func TestGCSFilter(t *testing.T) {
+	key := [16]byte{1, 2, 3}
+
+	var items [][]byte
+	for i := 0; i < 300; i++ {
+		items = append(items, []byte(fmt.Sprintf("item %d", i)))
+	}
+	// an output paying an address twice adds it twice
+	items = append(items, items[0], items[1], items[1])
+
+	filter := NewGCSFilter(key, items, gcsP, gcsM)
+	if filter.N != 300 {
+		t.Fatalf("N is %d, want the 300 distinct items", filter.N)
+	}
+
+	parsed, err := ParseGCSFilter(filter.Bytes(), gcsP, gcsM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.N != filter.N || string(parsed.Data) != string(filter.Data) {
+		t.Fatal("the filter changes in a round trip")
+	}
+
+	for _, item := range items {
+		if !parsed.Match(key, item) {
+			t.Fatalf("%s is missing", item)
+		}
+	}
+	if !parsed.MatchAny(key, [][]byte{[]byte("other"), items[150]}) {
+		t.Fatal("MatchAny misses a member")
+	}
+	if parsed.MatchAny(key, nil) {
+		t.Fatal("MatchAny of nothing matches")
+	}
+
+	// false positives occur at a rate of 1/M
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if parsed.Match(key, []byte(fmt.Sprintf("other %d", i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 2 {
+		t.Fatalf("%d false positives", falsePositives)
+	}
+
+	// another key hashes the items elsewhere
+	if parsed.MatchAny([16]byte{9}, items[:10]) {
+		t.Fatal("matched with the wrong key")
+	}
+}
+
+func TestGCSFilterDuplicatesOnly(t *testing.T) {
+	var key [16]byte
+	item := []byte("pubkeyhash")
+
+	filter := NewGCSFilter(key, [][]byte{item, item, item}, gcsP, gcsM)
+	parsed, err := ParseGCSFilter(filter.Bytes(), gcsP, gcsM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.N != 1 || !parsed.Match(key, item) {
+		t.Fatal("the duplicated item is missing")
+	}
+	if parsed.Match(key, []byte("other")) {
+		t.Fatal("matched past the end of the set")
+	}
+}
+
+func TestGCSFilterDeltas(t *testing.T) {
+	key := [16]byte{7}
+	items := [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("c"), []byte("b")}
+
+	// a decoder which trusts N reads exactly the values of the distinct items
+	filter := NewGCSFilter(key, items, gcsP, gcsM)
+	want := hashedSetValues(key, [][]byte{items[0], items[1], items[3]}, uint64(filter.N)*gcsM)
+	if filter.N != uint32(len(want)) {
+		t.Fatalf("N is %d for %d distinct items", filter.N, len(want))
+	}
+
+	r := bitReader{data: filter.Data}
+	var value uint64
+	for i := range want {
+		delta, ok := r.readGolombRice(gcsP)
+		if !ok {
+			t.Fatalf("the filter ends after %d of %d deltas", i, len(want))
+		}
+		value += delta
+		if value != want[i] {
+			t.Fatalf("value %d is %d, want %d", i, value, want[i])
+		}
+	}
+
+	// only the padding of the last byte is left
+	if _, ok := r.readGolombRice(gcsP); ok {
+		t.Fatal("the filter has more deltas than N")
+	}
+}
+
+func TestGCSFilterEmpty(t *testing.T) {
+	var key [16]byte
+
+	filter := NewGCSFilter(key, nil, gcsP, gcsM)
+	if filter.N != 0 || len(filter.Data) != 0 {
+		t.Fatal("an empty filter has data")
+	}
+
+	parsed, err := ParseGCSFilter(filter.Bytes(), gcsP, gcsM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Match(key, []byte("item")) || parsed.MatchAny(key, [][]byte{nil, []byte("x")}) {
+		t.Fatal("an empty filter matches")
+	}
+
+	if _, err := ParseGCSFilter(nil, gcsP, gcsM); err == nil {
+		t.Fatal("parsed a filter without its size")
+	}
+}
+
+func TestVerifyCFilters(t *testing.T) {
+	var key [16]byte
+	prevHeader := make([]byte, 32)
+
+	filters := &cfilters{}
+	var headers [][]byte
+	header := prevHeader
+	for i := 0; i < 3; i++ {
+		filter := NewGCSFilter(key, [][]byte{[]byte(fmt.Sprintf("block %d", i))}, gcsP, gcsM).Bytes()
+		header = filterHeader(filterHash(filter), header)
+
+		filters.BlockHashes = append(filters.BlockHashes, []byte{byte(i)})
+		filters.Filters = append(filters.Filters, filter)
+		headers = append(headers, header)
+	}
+
+	err := VerifyCFilters(filters, headers, prevHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamperedFilter := append([]byte{}, filters.Filters[1]...)
+	tamperedFilter[len(tamperedFilter)-1] ^= 1
+	tampered := &cfilters{BlockHashes: filters.BlockHashes, Filters: [][]byte{filters.Filters[0], tamperedFilter, filters.Filters[2]}}
+	if VerifyCFilters(tampered, headers, prevHeader) == nil {
+		t.Fatal("accepted a tampered filter")
+	}
+
+	tamperedHeader := append([]byte{}, headers[2]...)
+	tamperedHeader[0] ^= 1
+	if VerifyCFilters(filters, [][]byte{headers[0], headers[1], tamperedHeader}, prevHeader) == nil {
+		t.Fatal("accepted a tampered header")
+	}
+
+	if VerifyCFilters(filters, headers, headers[0]) == nil {
+		t.Fatal("accepted the filters after another previous header")
+	}
+	if VerifyCFilters(filters, headers[:2], prevHeader) == nil {
+		t.Fatal("accepted a missing header")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const hardenedKeyStart = 0x80000000
+
+// the chains of an account: addresses to receive coins and change addresses
+const (
+	externalChain = 0
+	internalChain = 1
+)
+
+// hdPath is the BIP44-style path of the key index of chain in account
+const hdPath = "m/44'/0'/%d'/%d/%d"
+
+// hdSchnorrPath is the BIP86-style path of the Schnorr keys
+const hdSchnorrPath = "m/86'/0'/%d'/%d/%d"
+
+var errInvalidChildKey = errors.New("Derived key is invalid, use the next index.")
+
+// ExtendedKey is a private key and the chain code deriving its child keys.
+type ExtendedKey struct {
+	Key       []byte
+	ChainCode []byte
+}
+
+// NewMnemonic generates a mnemonic of 12, 15, 18, 21 or 24 words.
+func NewMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", errors.New("A mnemonic has 12, 15, 18, 21 or 24 words.")
+	}
+
+	// every 3 words hold 32 bits of entropy and 1 bit of checksum
+	entropy, err := bip39.NewEntropy(words / 3 * 32)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicToSeed checks the mnemonic and stretches it with the passphrase to a seed.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+	return bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+}
+
+// NewMasterKey derives the root key of a seed.
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(btcec.S256().N) >= 0 {
+		return nil, errors.New("Seed gives an invalid master key.")
+	}
+
+	return &ExtendedKey{sum[:32], sum[32:]}, nil
+}
+
+// Child derives the child key at index, indexes from hardenedKeyStart on are hardened.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0}, k.Key...)
+	} else {
+		_, public := btcec.PrivKeyFromBytes(k.Key)
+		data = public.SerializeCompressed()
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := btcec.S256().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidChildKey
+	}
+
+	key := tweak.Add(tweak, new(big.Int).SetBytes(k.Key))
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errInvalidChildKey
+	}
+
+	return &ExtendedKey{key.FillBytes(make([]byte, 32)), sum[32:]}, nil
+}
+
+// Derive follows a path like m/44'/0'/0'/0/1 from the master key k.
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	elements := strings.Split(path, "/")
+	if elements[0] != "m" {
+		return nil, fmt.Errorf("Invalid derivation path %s.", path)
+	}
+
+	key := k
+	for _, element := range elements[1:] {
+		hardened := strings.HasSuffix(element, "'")
+		index, err := strconv.ParseUint(strings.TrimSuffix(element, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid derivation path %s.", path)
+		}
+		if hardened {
+			index += hardenedKeyStart
+		}
+
+		key, err = key.Child(uint32(index))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Fingerprint identifies k by the first 4 bytes of the hash of its public key.
+func (k *ExtendedKey) Fingerprint() []byte {
+	_, public := keyPairFromBytes(k.Key)
+
+	return HashPubKey(public)[:4]
+}
+
+// Wallet returns the key-pair of k, which was derived by path.
+func (k *ExtendedKey) Wallet(path string) *Wallet {
+	private, public := keyPairFromBytes(k.Key)
+
+	return &Wallet{private, public, path}
+}
+
+// SchnorrWallet returns the key-pair of k with the x-only public key.
+func (k *ExtendedKey) SchnorrWallet(path string) *Wallet {
+	private, _ := keyPairFromBytes(k.Key)
+
+	return &Wallet{private, schnorr.SerializePubKey(private.PubKey()), path}
+}
+
+// usedPubKeyHashes returns the PubKeyHashes which outputs of the chain pay to.
+func usedPubKeyHashes(bc *Blockchain) map[string]bool {
+	used := make(map[string]bool)
+	if bc == nil {
+		return used
+	}
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				used[string(out.PubKeyHash)] = true
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return used
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+)
+
+const mempoolFile = "mempool_%s.dat"
+
+// guards mempool, which is shared by the connection handlers and the miner
+var mempoolLock sync.Mutex
+
+// counts the changes of the mempool
+var mempoolSequence int
+
+// closed and replaced whenever a transaction enters or leaves the mempool
+var mempoolChanged = make(chan struct{})
+
+// SaveMempool dumps pending transactions so that they survive a node restart.
+func SaveMempool(nodeID string) {
+	var content bytes.Buffer
+	mempoolFile := fmt.Sprintf(mempoolFile, nodeID)
+
+	var txs []Transaction
+	mempoolLock.Lock()
+	for _, tx := range mempool {
+		txs = append(txs, tx)
+	}
+	mempoolLock.Unlock()
+
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(txs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = ioutil.WriteFile(mempoolFile, content.Bytes(), 0600)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Saved %d pending transactions to %s\n", len(txs), mempoolFile)
+}
+
+// LoadMempool restores the transactions dumped by SaveMempool.
+// Every transaction is verified against the current chainstate again,
+// because the chain may have moved on while the node was down.
+func LoadMempool(nodeID string, bc *Blockchain) int {
+	mempoolFile := fmt.Sprintf(mempoolFile, nodeID)
+	if _, err := os.Stat(mempoolFile); os.IsNotExist(err) {
+		return 0
+	}
+
+	fileContent, err := ioutil.ReadFile(mempoolFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var txs []Transaction
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err = decoder.Decode(&txs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	utxo := UTXOSet{bc}
+	restored := make([]bool, len(txs))
+	loaded := 0
+
+	// a restored transaction may spend the outputs of another one,
+	// so keep going until no more parents are found
+	for progress := true; progress; {
+		progress = false
+
+		for i := range txs {
+			if restored[i] {
+				continue
+			}
+
+			if _, ok := AcceptToMempool(&txs[i], utxo); ok {
+				restored[i] = true
+				loaded++
+				progress = true
+			}
+		}
+	}
+
+	for i, tx := range txs {
+		if !restored[i] {
+			fmt.Printf("Discard invalid pending transaction %x\n", tx.ID)
+		}
+	}
+
+	// the dump has been consumed. A new one is written on the next shutdown.
+	err = os.Remove(mempoolFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return loaded
+}
+
+// mempoolView returns the chainstate with all pending transactions applied.
+// It must be called with mempoolLock held.
+func mempoolView(utxo UTXOSet) *UTXOView {
+	view := NewUTXOView(utxo)
+	for id := range mempool {
+		tx := mempool[id]
+		view.Connect(&tx)
+	}
+
+	return view
+}
+
+// AcceptToMempool adds tx to the mempool if it spends confirmed or pending
+// outputs which no other pending transaction spends. It returns the fee of tx.
+func AcceptToMempool(tx *Transaction, utxo UTXOSet) (int, bool) {
+	// no coinbase transacton in the mempool
+	if tx.IsCoinbase() {
+		return 0, false
+	}
+
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := mempool[txID]; ok {
+		return 0, false
+	}
+
+	view := mempoolView(utxo)
+	fee, ok := view.CheckTransaction(tx)
+	if !ok {
+		return 0, false
+	}
+
+	// use map can sure that transactions in the block are different
+	mempool[txID] = *tx
+	notifyMempoolChanged()
+	publishTxAccepted(tx, fee)
+	utxo.Blockchain.trackWalletTx(tx, view)
+
+	return fee, true
+}
+
+func mempoolTransactions() []*Transaction {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	var txs []*Transaction
+	for id := range mempool {
+		tx := mempool[id]
+		txs = append(txs, &tx)
+	}
+
+	return txs
+}
+
+func mempoolTransaction(txID string) (Transaction, bool) {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	tx, ok := mempool[txID]
+	return tx, ok
+}
+
+func mempoolSize() int {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	return len(mempool)
+}
+
+// RemoveFromMempool drops the transactions of a connected block.
+func RemoveFromMempool(txs []*Transaction) {
+	removeFromMempool(txs, removeReasonBlock)
+}
+
+// EvictFromMempool drops transactions which can't be mined anymore, the
+// wallet of bc forgets them.
+func EvictFromMempool(bc *Blockchain, txs []*Transaction) {
+	removeFromMempool(txs, removeReasonRejected)
+	bc.forgetWalletTxs(txs)
+}
+
+func removeFromMempool(txs []*Transaction, reason string) {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	removed := false
+	for _, tx := range txs {
+		txID := hex.EncodeToString(tx.ID)
+		if _, ok := mempool[txID]; ok {
+			delete(mempool, txID)
+			publishTxRemoved(tx, reason)
+			removed = true
+		}
+	}
+
+	if removed {
+		notifyMempoolChanged()
+	}
+}
+
+// mempoolState returns the sequence number of the mempool and a channel
+// which is closed on the next change.
+func mempoolState() (int, <-chan struct{}) {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	return mempoolSequence, mempoolChanged
+}
+
+// notifyMempoolChanged must be called with mempoolLock held.
+func notifyMempoolChanged() {
+	mempoolSequence++
+	close(mempoolChanged)
+	mempoolChanged = make(chan struct{})
+}
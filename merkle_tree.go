@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 )
 
 type MerkleTree struct {
@@ -14,6 +16,14 @@ type MerkleNode struct {
 	Data  []byte
 }
 
+// MerkleProof shows that a leaf is in a tree with a known root. Hashes are the
+// siblings on the path from the leaf up to the root, Index is the position of
+// the leaf, its bits tell on which side each sibling is.
+type MerkleProof struct {
+	Index  int
+	Hashes [][]byte
+}
+
 func NewMerkleTree(data [][]byte) *MerkleTree {
 	var nodes []MerkleNode
 
@@ -30,6 +40,11 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 	for len(nodes) > 1 {
 		var newLevel []MerkleNode
 
+		// the last node of an odd level is paired with itself
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
 		for j := 0; j < len(nodes); j += 2 {
 			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
 			newLevel = append(newLevel, *node)
@@ -43,6 +58,52 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 	return &mTree
 }
 
+// Proof returns the inclusion proof of the leaf at index.
+func (t *MerkleTree) Proof(index int) (*MerkleProof, error) {
+	depth := 0
+	for node := t.RootNode; node.Left != nil; node = node.Left {
+		depth++
+	}
+
+	if index < 0 || index >= 1<<uint(depth) {
+		return nil, errors.New("Leaf index is out of range.")
+	}
+
+	// walks down from the root, the siblings are collected top to bottom
+	hashes := make([][]byte, depth)
+	node := t.RootNode
+	for level := depth - 1; level >= 0; level-- {
+		if index>>uint(level)&1 == 0 {
+			hashes[level] = node.Right.Data
+			node = node.Left
+		} else {
+			hashes[level] = node.Left.Data
+			node = node.Right
+		}
+	}
+
+	return &MerkleProof{index, hashes}, nil
+}
+
+// Verify reports whether the proof links the leaf data to root.
+func (p *MerkleProof) Verify(data, root []byte) bool {
+	hash := sha256.Sum256(data)
+	current := hash[:]
+
+	for i, sibling := range p.Hashes {
+		var pair []byte
+		if p.Index>>uint(i)&1 == 0 {
+			pair = append(append([]byte{}, current...), sibling...)
+		} else {
+			pair = append(append([]byte{}, sibling...), current...)
+		}
+		hash = sha256.Sum256(pair)
+		current = hash[:]
+	}
+
+	return p.Index>>uint(len(p.Hashes)) == 0 && bytes.Equal(current, root)
+}
+
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	mNode := MerkleNode{}
 
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds in seconds of the block validation latency histogram
+var validationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// NodeMetrics counts the P2P traffic and the block validations for /metrics.
+type NodeMetrics struct {
+	lock             sync.Mutex
+	messagesReceived map[string]int64
+	messagesSent     map[string]int64
+	bytesReceived    int64
+	bytesSent        int64
+	// open and total connections by direction, inbound or outbound
+	connections      map[string]int64
+	connectionsTotal map[string]int64
+
+	validationCounts []int64
+	validationCount  int64
+	validationSum    float64
+}
+
+var metrics = NewNodeMetrics()
+
+func NewNodeMetrics() *NodeMetrics {
+	return &NodeMetrics{
+		messagesReceived: make(map[string]int64),
+		messagesSent:     make(map[string]int64),
+		connections:      map[string]int64{"inbound": 0, "outbound": 0},
+		connectionsTotal: map[string]int64{"inbound": 0, "outbound": 0},
+		validationCounts: make([]int64, len(validationBuckets)),
+	}
+}
+
+func (m *NodeMetrics) MessageReceived(command string, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.messagesReceived[command]++
+	m.bytesReceived += int64(size)
+}
+
+func (m *NodeMetrics) MessageSent(command string, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.messagesSent[command]++
+	m.bytesSent += int64(size)
+}
+
+func (m *NodeMetrics) ConnectionOpened(direction string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.connections[direction]++
+	m.connectionsTotal[direction]++
+}
+
+func (m *NodeMetrics) ConnectionClosed(direction string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.connections[direction]--
+}
+
+func (m *NodeMetrics) ObserveBlockValidation(duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	seconds := duration.Seconds()
+	for i, bound := range validationBuckets {
+		if seconds <= bound {
+			m.validationCounts[i]++
+		}
+	}
+	m.validationCount++
+	m.validationSum += seconds
+}
+
+// EnableMetrics serves the metrics in the Prometheus text format under /metrics without authentication.
+func (s *RPCServer) EnableMetrics() {
+	s.Mux.HandleFunc("/metrics", handleMetrics)
+	fmt.Println("Metrics are enabled")
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var out bytes.Buffer
+
+	writeMetric := func(name, kind, help string) {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	if bc := getLocalChain(); bc != nil {
+		height, tipHash := bc.GetBestHeight()
+		tip, err := bc.GetBlock(tipHash)
+		if err == nil {
+			writeMetric("blockchain_height", "gauge", "Height of the tip.")
+			fmt.Fprintf(&out, "blockchain_height %d\n", height)
+			writeMetric("blockchain_tip_age_seconds", "gauge", "Seconds since the timestamp of the tip.")
+			fmt.Fprintf(&out, "blockchain_tip_age_seconds %d\n", time.Now().Unix()-tip.Timestamp)
+		}
+
+		utxo := UTXOSet{bc}
+		writeMetric("blockchain_utxo_transactions", "gauge", "Transactions with unspent outputs in the chainstate.")
+		fmt.Fprintf(&out, "blockchain_utxo_transactions %d\n", utxo.CountTransactions())
+	}
+
+	txs := mempoolTransactions()
+	mempoolBytes := 0
+	for _, tx := range txs {
+		mempoolBytes += len(tx.Serialize())
+	}
+	writeMetric("blockchain_mempool_transactions", "gauge", "Transactions in the mempool.")
+	fmt.Fprintf(&out, "blockchain_mempool_transactions %d\n", len(txs))
+	writeMetric("blockchain_mempool_bytes", "gauge", "Serialized size of the transactions in the mempool.")
+	fmt.Fprintf(&out, "blockchain_mempool_bytes %d\n", mempoolBytes)
+
+	writeMetric("blockchain_miner_hashes_per_second", "gauge", "Hash rate of the miner of this node.")
+	fmt.Fprintf(&out, "blockchain_miner_hashes_per_second %d\n", atomic.LoadInt64(&minerHashRate))
+
+	metrics.write(&out, writeMetric)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(out.Bytes())
+}
+
+func (m *NodeMetrics) write(out *bytes.Buffer, writeMetric func(name, kind, help string)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetric("blockchain_known_peers", "gauge", "Nodes this node sends messages to.")
+	fmt.Fprintf(out, "blockchain_known_peers %d\n", len(knownNodes))
+
+	writeMetric("blockchain_peer_connections", "gauge", "Open peer connections by direction.")
+	for _, direction := range sortedKeys(m.connections) {
+		fmt.Fprintf(out, "blockchain_peer_connections{direction=%q} %d\n", direction, m.connections[direction])
+	}
+	writeMetric("blockchain_peer_connections_total", "counter", "Peer connections by direction.")
+	for _, direction := range sortedKeys(m.connectionsTotal) {
+		fmt.Fprintf(out, "blockchain_peer_connections_total{direction=%q} %d\n", direction, m.connectionsTotal[direction])
+	}
+
+	writeMetric("blockchain_messages_received_total", "counter", "P2P messages received by command.")
+	for _, command := range sortedKeys(m.messagesReceived) {
+		fmt.Fprintf(out, "blockchain_messages_received_total{command=%q} %d\n", command, m.messagesReceived[command])
+	}
+	writeMetric("blockchain_messages_sent_total", "counter", "P2P messages sent by command.")
+	for _, command := range sortedKeys(m.messagesSent) {
+		fmt.Fprintf(out, "blockchain_messages_sent_total{command=%q} %d\n", command, m.messagesSent[command])
+	}
+
+	writeMetric("blockchain_received_bytes_total", "counter", "Bytes received from peers.")
+	fmt.Fprintf(out, "blockchain_received_bytes_total %d\n", m.bytesReceived)
+	writeMetric("blockchain_sent_bytes_total", "counter", "Bytes sent to peers.")
+	fmt.Fprintf(out, "blockchain_sent_bytes_total %d\n", m.bytesSent)
+
+	writeMetric("blockchain_block_validation_seconds", "histogram", "Time to validate a block against the chainstate.")
+	for i, bound := range validationBuckets {
+		fmt.Fprintf(out, "blockchain_block_validation_seconds_bucket{le=\"%g\"} %d\n", bound, m.validationCounts[i])
+	}
+	fmt.Fprintf(out, "blockchain_block_validation_seconds_bucket{le=\"+Inf\"} %d\n", m.validationCount)
+	fmt.Fprintf(out, "blockchain_block_validation_seconds_sum %g\n", m.validationSum)
+	fmt.Fprintf(out, "blockchain_block_validation_seconds_count %d\n", m.validationCount)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// number of goroutines searching for a nonce
+var minerThreads = runtime.NumCPU()
+
+const hashRateInterval = 10 * time.Second
+
+// how many hashes a worker computes between two checks for cancellation
+const hashBatch = 1024
+
+// the last measured hash rate in hashes per second
+var minerHashRate int64
+
+var errMiningAborted = errors.New("Mining is aborted.")
+
+type CPUMiner struct {
+	Threads int
+}
+
+func NewCPUMiner(threads int) *CPUMiner {
+	if threads < 1 {
+		threads = 1
+	}
+
+	return &CPUMiner{threads}
+}
+
+// Solve searches for a nonce which satisfies the pow of block and sets its
+// Nonce and Hash. The nonce space is split between the workers. When it is
+// exhausted, an extra nonce is put into the coinbase to change the merkle root.
+// Solve returns errMiningAborted as soon as ctx is done.
+func (m *CPUMiner) Solve(ctx context.Context, block *Block) error {
+	var hashes int64
+	done := make(chan struct{})
+	defer close(done)
+	go reportHashRate(&hashes, done)
+
+	coinbase := findCoinbase(block)
+	var coinbaseData []byte
+	if coinbase != nil {
+		coinbaseData = coinbase.Vin[0].PubKey
+	}
+
+	for extraNonce := int64(0); ; extraNonce++ {
+		if extraNonce > 0 {
+			if coinbase == nil {
+				return errors.New("Nonce range is exhausted and there is no coinbase for an extra nonce.")
+			}
+
+			coinbase.Vin[0].PubKey = append(append([]byte{}, coinbaseData...), IntToHex(extraNonce)...)
+			coinbase.ID = coinbase.Hash()
+			fmt.Printf("Nonce range is exhausted, try extra nonce %d\n", extraNonce)
+		}
+
+		nonce, hash, found := m.search(ctx, NewProofOfWork(block), &hashes)
+		if ctx.Err() != nil {
+			return errMiningAborted
+		}
+
+		if found {
+			block.Nonce = nonce
+			block.Hash = hash
+			fmt.Printf("Mined block %x after %d hashes\n", hash, atomic.LoadInt64(&hashes))
+			return nil
+		}
+	}
+}
+
+// search runs the workers over the whole nonce range for a fixed merkle root.
+func (m *CPUMiner) search(ctx context.Context, pow *ProofOfWork, hashes *int64) (int, []byte, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prefix := pow.prepareHeader(pow.block.HashTransactions())
+	chunk := maxNonce / m.Threads
+
+	var once sync.Once
+	var wg sync.WaitGroup
+	var nonce int
+	var hash []byte
+	found := false
+
+	for i := 0; i < m.Threads; i++ {
+		start := i * chunk
+		end := start + chunk
+		if i == m.Threads-1 {
+			end = maxNonce
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+
+			n, h, ok := searchRange(ctx, prefix, pow.target, start, end, hashes)
+			if ok {
+				once.Do(func() {
+					nonce, hash, found = n, h, true
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	return nonce, hash, found
+}
+
+// searchRange tries every nonce in [start, end).
+func searchRange(ctx context.Context, prefix []byte, target *big.Int, start, end int, hashes *int64) (int, []byte, bool) {
+	var hashInt big.Int
+	data := make([]byte, len(prefix)+8)
+	copy(data, prefix)
+
+	for nonce := start; nonce < end; nonce++ {
+		if (nonce-start)%hashBatch == 0 && nonce != start {
+			atomic.AddInt64(hashes, hashBatch)
+			if ctx.Err() != nil {
+				return 0, nil, false
+			}
+		}
+
+		binary.BigEndian.PutUint64(data[len(prefix):], uint64(nonce))
+		hash := sha256.Sum256(data)
+		hashInt.SetBytes(hash[:])
+
+		if hashInt.Cmp(target) == -1 {
+			atomic.AddInt64(hashes, int64((nonce-start)%hashBatch+1))
+			return nonce, hash[:], true
+		}
+	}
+
+	return 0, nil, false
+}
+
+func reportHashRate(hashes *int64, done chan struct{}) {
+	ticker := time.NewTicker(hashRateInterval)
+	defer ticker.Stop()
+
+	last := int64(0)
+	for {
+		select {
+		case <-ticker.C:
+			current := atomic.LoadInt64(hashes)
+			rate := (current - last) / int64(hashRateInterval/time.Second)
+			last = current
+
+			atomic.StoreInt64(&minerHashRate, rate)
+			fmt.Printf("Mining at %d H/s\n", rate)
+		case <-done:
+			return
+		}
+	}
+}
+
+func findCoinbase(block *Block) *Transaction {
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			return tx
+		}
+	}
+
+	return nil
+}
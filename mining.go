@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// target time between two blocks, which paces mining on regtest-like networks
+// where the pow is trivial. 0 mines as fast as possible.
+var miningInterval = 10 * time.Second
+
+// the mining loop of this node. It is nil unless the node is a miner.
+var miningLoop *MiningLoop
+
+// MiningLoop continuously mines blocks on top of the tip with the best
+// transactions from the mempool, coinbase-only blocks included.
+type MiningLoop struct {
+	address  string
+	interval time.Duration
+
+	lock       sync.Mutex
+	paused     bool
+	mining     bool
+	minFeeRate float64
+	restart    context.CancelFunc
+	// wakes up the loop when it is paused or waiting for the next block time
+	wake chan struct{}
+}
+
+func NewMiningLoop(address string, interval time.Duration) *MiningLoop {
+	return &MiningLoop{address: address, interval: interval, wake: make(chan struct{}, 1)}
+}
+
+func (m *MiningLoop) Run() {
+	for {
+		bc := getLocalChain()
+		if bc == nil {
+			// wait for the genesis block
+			m.sleep(time.Second)
+			continue
+		}
+
+		if m.isPaused() {
+			<-m.wake
+			continue
+		}
+
+		tipChanged := bc.TipChanged()
+		if wait := m.nextBlockTime(bc); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-tipChanged:
+				continue
+			case <-m.wake:
+				continue
+			}
+		}
+
+		utxo := UTXOSet{bc}
+		template := NewBlockTemplate(&utxo, mempoolTransactions(), m.address, maxBlockSize)
+		EvictFromMempool(bc, template.Rejected)
+
+		ctx := m.begin(template)
+		newBlock, err := bc.MineBlock(ctx, template.Transactions)
+		m.end()
+
+		if err != nil {
+			fmt.Printf("Restart mining: %s\n", err)
+			continue
+		}
+
+		fmt.Printf("New block %x is mined with %d transactions!\n", newBlock.Hash, len(newBlock.Transactions))
+		RemoveFromMempool(newBlock.Transactions)
+
+		for node, _ := range knownNodes {
+			if node != nodeAddress {
+				sendInv(node, "block", [][]byte{newBlock.Hash})
+			}
+		}
+	}
+}
+
+// nextBlockTime returns how long to wait until the interval since the tip has passed.
+func (m *MiningLoop) nextBlockTime(bc *Blockchain) time.Duration {
+	if m.interval <= 0 {
+		return 0
+	}
+
+	_, tipHash := bc.GetBestHeight()
+	tip, err := bc.GetBlock(tipHash)
+	if err != nil {
+		return 0
+	}
+
+	return time.Until(time.Unix(tip.Timestamp, 0).Add(m.interval))
+}
+
+func (m *MiningLoop) begin(template *BlockTemplate) context.Context {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mining = true
+	m.restart = cancel
+	m.minFeeRate = template.MinFeeRate
+	if len(template.Transactions) == 1 {
+		// any paying transaction is better than an empty block
+		m.minFeeRate = 0
+	}
+
+	return ctx
+}
+
+func (m *MiningLoop) end() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.mining = false
+	m.restart()
+}
+
+// NotifyTransaction restarts mining when a new pending transaction pays a
+// higher fee rate than the worst one in the current template.
+func (m *MiningLoop) NotifyTransaction(feeRate float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.mining && feeRate > m.minFeeRate {
+		fmt.Printf("A transaction with fee rate %.4f arrives, rebuild the block template.\n", feeRate)
+		m.restart()
+	}
+}
+
+func (m *MiningLoop) Pause() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.paused = true
+	if m.mining {
+		m.restart()
+	}
+	m.signal()
+}
+
+func (m *MiningLoop) Resume() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.paused = false
+	m.signal()
+}
+
+func (m *MiningLoop) isPaused() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.paused
+}
+
+func (m *MiningLoop) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MiningLoop) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-m.wake:
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+)
+
+// how long a gettemplate request waits for a new template
+const longPollTimeout = 60 * time.Second
+
+// gettemplate asks for work. If LongPollID equals the ID of the current
+// template, the node holds the request until the tip or the mempool changes.
+type gettemplate struct {
+	AddrFrom   string
+	Address    string
+	LongPollID string
+}
+
+// blocktemplate is the answer to gettemplate. Coinbase pays CoinbaseValue
+// to the requested address; a miner may append an extra nonce to its input data.
+type blocktemplate struct {
+	LongPollID    string
+	PrevBlockHash []byte
+	Height        int
+	Timestamp     int64
+	TargetBits    int
+	Target        []byte
+	CoinbaseValue int
+	Coinbase      []byte
+	Transactions  [][]byte
+	Error         string
+}
+
+type submitblock struct {
+	AddrFrom string
+	Block    []byte
+}
+
+type submitresult struct {
+	Accepted bool
+	Reason   string
+}
+
+// requestData sends a request and reads the answer from the same connection.
+func requestData(addr string, data []byte) ([]byte, error) {
+	conn, err := net.Dial(protocol, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	metrics.ConnectionOpened("outbound")
+	defer metrics.ConnectionClosed("outbound")
+
+	_, err = conn.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MessageSent(bytesToCommand(data[:commandLength]), len(data))
+
+	// the node reads the request until EOF
+	err = conn.(*net.TCPConn).CloseWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) < commandLength {
+		return nil, errors.New("Empty response.")
+	}
+	metrics.MessageReceived(bytesToCommand(response[:commandLength]), len(response))
+
+	return response, nil
+}
+
+func requestBlockTemplate(addr, address, longPollID string) (*blocktemplate, error) {
+	payload := gobEncode(gettemplate{nodeAddress, address, longPollID})
+	request := append(commandToBytes("gettemplate"), payload...)
+
+	response, err := requestData(addr, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var template blocktemplate
+	dec := gob.NewDecoder(bytes.NewReader(response[commandLength:]))
+	err = dec.Decode(&template)
+	if err != nil {
+		return nil, err
+	}
+
+	if template.Error != "" {
+		return nil, errors.New(template.Error)
+	}
+
+	return &template, nil
+}
+
+func requestSubmitBlock(addr string, block *Block) (*submitresult, error) {
+	payload := gobEncode(submitblock{nodeAddress, block.Serialize()})
+	request := append(commandToBytes("submitblock"), payload...)
+
+	response, err := requestData(addr, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result submitresult
+	dec := gob.NewDecoder(bytes.NewReader(response[commandLength:]))
+	err = dec.Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func respond(conn net.Conn, command string, data interface{}) {
+	response := append(commandToBytes(command), gobEncode(data)...)
+
+	_, err := conn.Write(response)
+	if err != nil {
+		fmt.Printf("Failed to respond %s: %s\n", command, err)
+		return
+	}
+	metrics.MessageSent(command, len(response))
+}
+
+func handleGetTemplate(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload gettemplate
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if bc == nil {
+		respond(conn, "template", blocktemplate{Error: "I don't have a blockchain."})
+		return
+	}
+
+	if !ValidateAddress(payload.Address) {
+		respond(conn, "template", blocktemplate{Error: "Address is not valid."})
+		return
+	}
+
+	timeout := time.After(longPollTimeout)
+	for {
+		tipChanged := bc.TipChanged()
+		sequence, mempoolChanged := mempoolState()
+		_, tipHash := bc.GetBestHeight()
+
+		longPollID := fmt.Sprintf("%x-%d", tipHash, sequence)
+		if longPollID != payload.LongPollID {
+			respond(conn, "template", newBlockTemplateMessage(bc, payload.Address, longPollID))
+			return
+		}
+
+		select {
+		case <-tipChanged:
+		case <-mempoolChanged:
+		case <-timeout:
+			respond(conn, "template", newBlockTemplateMessage(bc, payload.Address, longPollID))
+			return
+		}
+	}
+}
+
+func newBlockTemplateMessage(bc *Blockchain, address, longPollID string) blocktemplate {
+	utxo := UTXOSet{bc}
+	template := NewBlockTemplate(&utxo, mempoolTransactions(), address, maxBlockSize)
+	EvictFromMempool(bc, template.Rejected)
+
+	coinbase := template.Transactions[0]
+	var txs [][]byte
+	for _, tx := range template.Transactions[1:] {
+		txs = append(txs, tx.Serialize())
+	}
+
+	return blocktemplate{
+		LongPollID:    longPollID,
+		PrevBlockHash: template.PrevBlockHash,
+		Height:        template.Height,
+		Timestamp:     time.Now().Unix(),
+		TargetBits:    targetBits,
+		Target:        NewProofOfWork(&Block{}).target.Bytes(),
+		CoinbaseValue: coinbase.OutputValue(),
+		Coinbase:      coinbase.Serialize(),
+		Transactions:  txs,
+	}
+}
+
+func handleSubmitBlock(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload submitblock
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if bc == nil {
+		respond(conn, "submitresult", submitresult{false, "I don't have a blockchain."})
+		return
+	}
+
+	block := DeserializeBlock(payload.Block)
+	if !bc.ConnectBlock(block) {
+		respond(conn, "submitresult", submitresult{false, "Block is invalid or stale."})
+		return
+	}
+
+	fmt.Printf("Accept block %x from miner %s\n", block.Hash, payload.AddrFrom)
+	RemoveFromMempool(block.Transactions)
+	respond(conn, "submitresult", submitresult{true, ""})
+
+	for node, _ := range knownNodes {
+		if node != nodeAddress {
+			sendInv(node, "block", [][]byte{block.Hash})
+		}
+	}
+}
+
+// Block assembles the block to mine from the template.
+func (t *blocktemplate) Block() *Block {
+	coinbase := DeserializeTransaction(t.Coinbase)
+	txs := []*Transaction{&coinbase}
+
+	for _, data := range t.Transactions {
+		tx := DeserializeTransaction(data)
+		txs = append(txs, &tx)
+	}
+
+	return &Block{t.Timestamp, txs, t.PrevBlockHash, []byte{}, 0, t.Height}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+)
+
+// MuSigSession is the part of one signer in a MuSig2 signature of a
+// transaction spending from the aggregated key of all the signers.
+// The signers exchange their nonces first, then their partial signatures.
+type MuSigSession struct {
+	session *musig2.Session
+}
+
+func parseSignerPubKeys(pubKeys [][]byte) ([]*btcec.PublicKey, error) {
+	var keys []*btcec.PublicKey
+	for _, pubKey := range pubKeys {
+		key, err := ParsePubKey(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// AggregatePubKeys combines the compressed public keys of the signers into the
+// x-only key of a Schnorr signature by all of them. The order doesn't matter.
+func AggregatePubKeys(pubKeys [][]byte) ([]byte, error) {
+	keys, err := parseSignerPubKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated, _, _, err := musig2.AggregateKeys(keys, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return schnorr.SerializePubKey(aggregated.FinalKey), nil
+}
+
+// NewMuSigSession starts signing with privKey for the signers of pubKeys,
+// which include the own public key.
+func NewMuSigSession(privKey *btcec.PrivateKey, pubKeys [][]byte) (*MuSigSession, error) {
+	keys, err := parseSignerPubKeys(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	context, err := musig2.NewContext(privKey, true, musig2.WithKnownSigners(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := context.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MuSigSession{session}, nil
+}
+
+// PublicNonce is the nonce to send to the other signers.
+func (s *MuSigSession) PublicNonce() []byte {
+	nonce := s.session.PublicNonce()
+
+	return nonce[:]
+}
+
+// RegisterNonce takes the public nonce of another signer.
+func (s *MuSigSession) RegisterNonce(nonce []byte) error {
+	var pubNonce [musig2.PubNonceSize]byte
+	if len(nonce) != len(pubNonce) {
+		return errors.New("Invalid public nonce.")
+	}
+	copy(pubNonce[:], nonce)
+
+	_, err := s.session.RegisterPubNonce(pubNonce)
+
+	return err
+}
+
+// Sign returns the partial signature of tx to send to the other signers, once
+// the nonces of all of them are registered. A session signs only once.
+func (s *MuSigSession) Sign(tx *Transaction) ([]byte, error) {
+	var hash [32]byte
+	copy(hash[:], tx.SignatureHash())
+
+	partial, err := s.session.Sign(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	err = partial.Encode(&encoded)
+
+	return encoded.Bytes(), err
+}
+
+// CombineSignature takes the partial signature of another signer. When all of
+// them are there, they add up to the signature of the aggregated key, which
+// Finish puts into tx.
+func (s *MuSigSession) CombineSignature(partial []byte) error {
+	if len(partial) != 32 {
+		return errors.New("Invalid partial signature.")
+	}
+
+	var sig musig2.PartialSignature
+	err := sig.Decode(bytes.NewReader(partial))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.session.CombineSig(&sig)
+
+	return err
+}
+
+// Finish puts the combined signature into the inputs of tx which spend from
+// the aggregated key.
+func (s *MuSigSession) Finish(tx *Transaction, aggregatedKey []byte) error {
+	signature := s.session.FinalSig()
+	if signature == nil {
+		return errors.New("The partial signatures of some signers are missing.")
+	}
+
+	for inID, vin := range tx.Vin {
+		if bytes.Equal(vin.PubKey, aggregatedKey) {
+			tx.Vin[inID].Signature = signature.Serialize()
+		}
+	}
+
+	return nil
+}
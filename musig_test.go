@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMuSig(t *testing.T) {
+	signers := []*Wallet{NewWallet(), NewWallet(), NewWallet()}
+	var pubKeys [][]byte
+	for _, signer := range signers {
+		pubKeys = append(pubKeys, signer.PublicKey)
+	}
+
+	aggregated, err := AggregatePubKeys(pubKeys)
+	if err != nil || len(aggregated) != schnorrPubKeyLen {
+		t.Fatal(aggregated, err)
+	}
+	reordered, _ := AggregatePubKeys([][]byte{pubKeys[2], pubKeys[0], pubKeys[1]})
+	if !bytes.Equal(aggregated, reordered) {
+		t.Fatal("the aggregated key depends on the order of the signers")
+	}
+
+	to := NewWallet()
+	tx := Transaction{nil, []TXInput{{[]byte("funding"), 0, nil, aggregated}}, []TXOutput{*NewTXOutput(6, string(to.GetAddress()))}}
+	tx.ID = tx.UnsignedHash()
+
+	var sessions []*MuSigSession
+	for _, signer := range signers {
+		session, err := NewMuSigSession(signer.PrivateKey, pubKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+	for i, session := range sessions {
+		for j, other := range sessions {
+			if i == j {
+				continue
+			}
+			err := session.RegisterNonce(other.PublicNonce())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var partials [][]byte
+	for _, session := range sessions {
+		partial, err := session.Sign(&tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, partial)
+	}
+
+	err = sessions[0].Finish(&tx, aggregated)
+	if err == nil {
+		t.Fatal("finished without the partial signatures of the others")
+	}
+	for _, partial := range partials[1:] {
+		err := sessions[0].CombineSignature(partial)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = sessions[0].Finish(&tx, aggregated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tx.Vin[0].Signature) != 64 || !tx.Verify() {
+		t.Fatal("the MuSig2 signature doesn't verify")
+	}
+
+	tx.Vout[0].Value++
+	if tx.Verify() {
+		t.Fatal("the signature verifies for another transaction")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Payment is one recipient of sendmany.
+type Payment struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// ParsePayments reads a list of payments as JSON, either an array of
+// {"address": ..., "amount": ...} or an object of address to amount, or as
+// CSV lines of address,amount with an optional header and # comments.
+func ParsePayments(data []byte) ([]Payment, error) {
+	var payments []Payment
+	var err error
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		err = json.Unmarshal(trimmed, &payments)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		payments, err = parsePaymentObject(trimmed)
+	default:
+		payments, err = parsePaymentCSV(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payments) == 0 {
+		return nil, errors.New("There are no payments.")
+	}
+	for _, payment := range payments {
+		if !ValidateAddress(payment.Address) {
+			return nil, fmt.Errorf("Invalid address %s.", payment.Address)
+		}
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("The amount to %s must be positive.", payment.Address)
+		}
+	}
+
+	return payments, nil
+}
+
+// parsePaymentObject orders the payments by address, as the object has no order.
+func parsePaymentObject(data []byte) ([]Payment, error) {
+	var amounts map[string]int
+	err := json.Unmarshal(data, &amounts)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []Payment
+	for address, amount := range amounts {
+		payments = append(payments, Payment{address, amount})
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].Address < payments[j].Address
+	})
+
+	return payments, nil
+}
+
+func parsePaymentCSV(data []byte) ([]Payment, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var payments []Payment
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		address := strings.TrimSpace(record[0])
+		amount, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			// a header like address,amount
+			if line == 0 {
+				continue
+			}
+			row, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("Invalid amount %q in line %d.", record[1], row)
+		}
+
+		payments = append(payments, Payment{address, amount})
+	}
+
+	return payments, nil
+}
+
+// PaymentOutputs turns the payments into the outputs of a transaction.
+func PaymentOutputs(payments []Payment) []TXOutput {
+	var outputs []TXOutput
+	for _, payment := range payments {
+		outputs = append(outputs, *NewTXOutput(payment.Amount, payment.Address))
+	}
+
+	return outputs
+}
@@ -31,10 +31,7 @@ func NewProofOfWork(b *Block) *ProofOfWork {
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
 	data := bytes.Join(
 		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targetBits)),
+			pow.prepareHeader(pow.block.HashTransactions()),
 			IntToHex(int64(nonce)),
 		},
 		[]byte{},
@@ -43,29 +40,19 @@ func (pow *ProofOfWork) prepareData(nonce int) []byte {
 	return data
 }
 
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var hashInt big.Int
-	var hash [32]byte
-	nonce := 0
-
-	fmt.Printf("Mining a new block")
-	for nonce < maxNonce {
-		data := pow.prepareData(nonce)
-
-		hash = sha256.Sum256(data)
-		fmt.Printf("\r%x", hash)
-		hashInt.SetBytes(hash[:])
-
-		if hashInt.Cmp(pow.target) == -1 {
-			break
-		} else {
-			nonce++
-		}
-	}
-
-	fmt.Print("\n\n")
+// prepareHeader returns the hashed data without the nonce.
+func (pow *ProofOfWork) prepareHeader(merkleRoot []byte) []byte {
+	data := bytes.Join(
+		[][]byte{
+			pow.block.PrevBlockHash,
+			merkleRoot,
+			IntToHex(pow.block.Timestamp),
+			IntToHex(int64(targetBits)),
+		},
+		[]byte{},
+	)
 
-	return nonce, hash[:]
+	return data
 }
 
 func (pow *ProofOfWork) Validate() bool {
@@ -88,3 +75,17 @@ func (pow *ProofOfWork) Validate() bool {
 
 	return false
 }
+
+// ValidateHeader checks the pow of a block header, the merkle root in there
+// stands for the transactions.
+func ValidateHeader(header BlockHeader) bool {
+	var hashInt big.Int
+
+	pow := NewProofOfWork(&Block{Timestamp: header.Timestamp, PrevBlockHash: header.PrevBlockHash})
+	data := append(pow.prepareHeader(header.MerkleRoot), IntToHex(int64(header.Nonce))...)
+
+	hash := sha256.Sum256(data)
+	hashInt.SetBytes(hash[:])
+
+	return hashInt.Cmp(pow.target) == -1 && bytes.Equal(hash[:], header.Hash)
+}
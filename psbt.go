@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// the bytes in front of a serialized PSBT, as in BIP174
+var psbtMagic = []byte("psbt\xff")
+
+// KeyDerivation tells the signer holding the seed of Fingerprint that it
+// derives PubKey by Path.
+type KeyDerivation struct {
+	PubKey      []byte
+	Fingerprint []byte
+	Path        string
+}
+
+// PartialSignature is the signature of an input by one key.
+type PartialSignature struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+type PSBTInput struct {
+	// the output which the input spends, nil until an update finds it
+	PrevOut     *TXOutput
+	PartialSigs []PartialSignature
+	Derivations []KeyDerivation
+	// the public key and signature which finalizing picks for the transaction
+	FinalPubKey    []byte
+	FinalSignature []byte
+}
+
+type PSBTOutput struct {
+	Derivations []KeyDerivation
+}
+
+// PSBT is a partially signed transaction: an unsigned transaction with what
+// the parties need to sign its inputs and the signatures they have made. It is
+// passed around as base64 and signed, combined and finalized in any order.
+type PSBT struct {
+	Tx      Transaction
+	Inputs  []PSBTInput
+	Outputs []PSBTOutput
+}
+
+// NewPSBT takes the inputs and outputs of an unsigned transaction.
+func NewPSBT(tx *Transaction) (*PSBT, error) {
+	if tx.IsCoinbase() || len(tx.Vin) == 0 {
+		return nil, errors.New("A PSBT needs a transaction with inputs.")
+	}
+
+	unsigned := Transaction{nil, nil, append([]TXOutput{}, tx.Vout...)}
+	for _, vin := range tx.Vin {
+		if len(vin.Signature) > 0 {
+			return nil, errors.New("The transaction is signed already.")
+		}
+		unsigned.Vin = append(unsigned.Vin, TXInput{vin.Txid, vin.Vout, nil, nil})
+	}
+	unsigned.ID = unsigned.Hash()
+
+	return &PSBT{unsigned, make([]PSBTInput, len(unsigned.Vin)), make([]PSBTOutput, len(unsigned.Vout))}, nil
+}
+
+// Serialize encodes p as base64.
+func (p *PSBT) Serialize() string {
+	encoded := bytes.NewBuffer(append([]byte{}, psbtMagic...))
+
+	enc := gob.NewEncoder(encoded)
+	err := enc.Encode(p)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(encoded.Bytes())
+}
+
+// ParsePSBT decodes untrusted base64 and reports malformed input instead of panicking.
+func ParsePSBT(s string) (*PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, psbtMagic) {
+		return nil, errors.New("This is not a PSBT.")
+	}
+
+	var p PSBT
+	decoder := gob.NewDecoder(bytes.NewReader(data[len(psbtMagic):]))
+	err = decoder.Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Tx.Vin) == 0 || len(p.Inputs) != len(p.Tx.Vin) || len(p.Outputs) != len(p.Tx.Vout) {
+		return nil, errors.New("The PSBT doesn't match its transaction.")
+	}
+	for _, vin := range p.Tx.Vin {
+		if len(vin.PubKey) > 0 || len(vin.Signature) > 0 {
+			return nil, errors.New("The transaction of the PSBT is signed.")
+		}
+	}
+
+	return &p, nil
+}
+
+// Fee is what the outputs leave of the inputs, known once every previous output is.
+func (p *PSBT) Fee() (int, bool) {
+	fee := -p.Tx.OutputValue()
+	for _, in := range p.Inputs {
+		if in.PrevOut == nil {
+			return 0, false
+		}
+		fee += in.PrevOut.Value
+	}
+
+	return fee, true
+}
+
+// Update fills in the previous outputs which prevOut finds and the derivations
+// of the keys of wallets which the inputs spend from or the outputs pay to.
+func (p *PSBT) Update(prevOut func(txid []byte, vout int) (TXOutput, bool), wallets *Wallets) {
+	for i, vin := range p.Tx.Vin {
+		in := &p.Inputs[i]
+		if in.PrevOut == nil {
+			if out, ok := prevOut(vin.Txid, vin.Vout); ok {
+				in.PrevOut = &out
+			}
+		}
+		if in.PrevOut != nil {
+			in.Derivations = addDerivation(in.Derivations, wallets, in.PrevOut.PubKeyHash)
+		}
+	}
+
+	for i, vout := range p.Tx.Vout {
+		p.Outputs[i].Derivations = addDerivation(p.Outputs[i].Derivations, wallets, vout.PubKeyHash)
+	}
+}
+
+// addDerivation adds the derivation of the HD key of wallets which pubKeyHash belongs to.
+func addDerivation(derivations []KeyDerivation, wallets *Wallets, pubKeyHash []byte) []KeyDerivation {
+	if wallets == nil {
+		return derivations
+	}
+
+	wallet := wallets.Wallets[PubKeyHashToAddress(pubKeyHash)]
+	fingerprint := wallets.MasterFingerprint()
+	if wallet == nil || wallet.Path == "" || fingerprint == nil {
+		return derivations
+	}
+
+	for _, derivation := range derivations {
+		if bytes.Equal(derivation.PubKey, wallet.PublicKey) {
+			return derivations
+		}
+	}
+
+	return append(derivations, KeyDerivation{wallet.PublicKey, fingerprint, wallet.Path})
+}
+
+// inputTx is the transaction of p with pubKey and signature in the input inID.
+func (p *PSBT) inputTx(inID int, pubKey, signature []byte) *Transaction {
+	tx := p.Tx
+	tx.Vin = append([]TXInput{}, p.Tx.Vin...)
+	tx.Vin[inID].PubKey = pubKey
+	tx.Vin[inID].Signature = signature
+
+	return &tx
+}
+
+// Sign adds a partial signature to every input whose previous output a key of
+// keys locks. It returns the number of inputs signed.
+func (p *PSBT) Sign(keys SigningKeys) int {
+	signed := 0
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.PrevOut == nil || in.FinalSignature != nil {
+			continue
+		}
+
+		wallet := keys[string(in.PrevOut.PubKeyHash)]
+		if wallet == nil || wallet.PrivateKey == nil {
+			continue
+		}
+
+		tx := p.inputTx(i, wallet.PublicKey, nil)
+		tx.SignInput(i, wallet.PrivateKey)
+		in.addPartialSig(PartialSignature{wallet.PublicKey, tx.Vin[i].Signature})
+		signed++
+	}
+
+	return signed
+}
+
+// addPartialSig keeps the signature there is of the same key.
+func (in *PSBTInput) addPartialSig(sig PartialSignature) {
+	for _, partialSig := range in.PartialSigs {
+		if bytes.Equal(partialSig.PubKey, sig.PubKey) {
+			return
+		}
+	}
+
+	in.PartialSigs = append(in.PartialSigs, sig)
+}
+
+// Combine merges what other knows of the same transaction into p.
+func (p *PSBT) Combine(other *PSBT) error {
+	if !bytes.Equal(p.Tx.Hash(), other.Tx.Hash()) {
+		return errors.New("The PSBTs are of different transactions.")
+	}
+
+	for i := range p.Inputs {
+		in, otherIn := &p.Inputs[i], other.Inputs[i]
+		if in.FinalSignature != nil {
+			continue
+		}
+		if otherIn.FinalSignature != nil {
+			*in = otherIn
+			continue
+		}
+
+		if in.PrevOut == nil {
+			in.PrevOut = otherIn.PrevOut
+		}
+		for _, sig := range otherIn.PartialSigs {
+			in.addPartialSig(sig)
+		}
+		in.Derivations = mergeDerivations(in.Derivations, otherIn.Derivations)
+	}
+
+	for i := range p.Outputs {
+		p.Outputs[i].Derivations = mergeDerivations(p.Outputs[i].Derivations, other.Outputs[i].Derivations)
+	}
+
+	return nil
+}
+
+func mergeDerivations(derivations, others []KeyDerivation) []KeyDerivation {
+	for _, other := range others {
+		known := false
+		for _, derivation := range derivations {
+			if bytes.Equal(derivation.PubKey, other.PubKey) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			derivations = append(derivations, other)
+		}
+	}
+
+	return derivations
+}
+
+// finalSignature is the valid partial signature of the key which the previous
+// output of the input inID is locked to.
+func (p *PSBT) finalSignature(inID int) (PartialSignature, bool) {
+	in := p.Inputs[inID]
+	if in.PrevOut == nil {
+		return PartialSignature{}, false
+	}
+
+	for _, sig := range in.PartialSigs {
+		if !bytes.Equal(HashPubKey(sig.PubKey), in.PrevOut.PubKeyHash) {
+			continue
+		}
+		if p.inputTx(inID, sig.PubKey, sig.Signature).VerifyInput(inID) {
+			return sig, true
+		}
+	}
+
+	return PartialSignature{}, false
+}
+
+// IsSigned reports whether every input is final or has the signature to finalize it.
+func (p *PSBT) IsSigned() bool {
+	for i, in := range p.Inputs {
+		if in.FinalSignature != nil {
+			continue
+		}
+		if _, ok := p.finalSignature(i); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Finalize picks the signature of every input which has a valid one and drops
+// what the signers needed. It returns whether every input is final.
+func (p *PSBT) Finalize() bool {
+	complete := true
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalSignature != nil {
+			continue
+		}
+
+		sig, ok := p.finalSignature(i)
+		if !ok {
+			complete = false
+			continue
+		}
+
+		in.FinalPubKey, in.FinalSignature = sig.PubKey, sig.Signature
+		in.PartialSigs, in.Derivations = nil, nil
+	}
+
+	return complete
+}
+
+// Extract returns the signed transaction of a finalized PSBT.
+func (p *PSBT) Extract() (*Transaction, error) {
+	tx := p.Tx
+	tx.Vin = append([]TXInput{}, p.Tx.Vin...)
+	for i, in := range p.Inputs {
+		if in.FinalSignature == nil {
+			return nil, fmt.Errorf("Input %d is not finalized.", i)
+		}
+		tx.Vin[i].PubKey = in.FinalPubKey
+		tx.Vin[i].Signature = in.FinalSignature
+	}
+	tx.ID = tx.UnsignedHash()
+
+	if !tx.Verify() {
+		return nil, errors.New("The signatures of the transaction are invalid.")
+	}
+
+	return &tx, nil
+}
+
+// AddDerivations adds the keys which the seed of wallets derives by the
+// derivations of the inputs of p, for keys which the wallet doesn't store.
+func (k SigningKeys) AddDerivations(wallets *Wallets, p *PSBT) {
+	fingerprint := wallets.MasterFingerprint()
+	if fingerprint == nil {
+		return
+	}
+	master, err := NewMasterKey(wallets.Seed)
+	if err != nil {
+		return
+	}
+
+	for _, in := range p.Inputs {
+		for _, derivation := range in.Derivations {
+			if !bytes.Equal(derivation.Fingerprint, fingerprint) {
+				continue
+			}
+
+			key, err := master.Derive(derivation.Path)
+			if err != nil {
+				continue
+			}
+			for _, wallet := range []*Wallet{key.Wallet(derivation.Path), key.SchnorrWallet(derivation.Path)} {
+				if bytes.Equal(wallet.PublicKey, derivation.PubKey) {
+					k[string(HashPubKey(wallet.PublicKey))] = wallet
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// RawInput is an outpoint which createrawtransaction spends.
+type RawInput struct {
+	TxID string `json:"txid"`
+	Vout int    `json:"vout"`
+}
+
+// PrevOut is an output which an input spends, given to signrawtransaction
+// where the chain is not at hand.
+type PrevOut struct {
+	TxID    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// RawSignError tells why an input isn't signed.
+type RawSignError struct {
+	TxID  string `json:"txid"`
+	Vout  int    `json:"vout"`
+	Error string `json:"error"`
+}
+
+// SignRawJSON is the result of signrawtransaction.
+type SignRawJSON struct {
+	Hex      string         `json:"hex"`
+	Complete bool           `json:"complete"`
+	Errors   []RawSignError `json:"errors,omitempty"`
+}
+
+// CreateRawTransaction builds an unsigned transaction spending inputs and
+// paying payments. There is no change, the difference to the inputs is the fee.
+func CreateRawTransaction(inputs []RawInput, payments []Payment) (*Transaction, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("A transaction needs an input.")
+	}
+
+	var vin []TXInput
+	used := make(map[string]bool)
+	for _, input := range inputs {
+		txID, err := hex.DecodeString(input.TxID)
+		if err != nil || len(txID) == 0 {
+			return nil, fmt.Errorf("Invalid txid %s.", input.TxID)
+		}
+		if input.Vout < 0 {
+			return nil, fmt.Errorf("Invalid vout %d.", input.Vout)
+		}
+
+		key := outpointKey(txID, input.Vout)
+		if used[key] {
+			return nil, fmt.Errorf("Input %s is spent twice.", key)
+		}
+		used[key] = true
+
+		vin = append(vin, TXInput{txID, input.Vout, nil, nil})
+	}
+
+	tx := Transaction{nil, vin, PaymentOutputs(payments)}
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
+
+// DecodeRawTransaction parses a hex-encoded serialized transaction.
+func DecodeRawTransaction(txHex string) (*Transaction, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(txHex))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTransaction(data)
+}
+
+// ParsePrevOuts reads the JSON array of outputs which inputs spend.
+func ParsePrevOuts(data []byte) (map[string]TXOutput, error) {
+	var prevOuts []PrevOut
+	err := json.Unmarshal(data, &prevOuts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]TXOutput)
+	for _, prevOut := range prevOuts {
+		txID, err := hex.DecodeString(prevOut.TxID)
+		if err != nil || len(txID) == 0 {
+			return nil, fmt.Errorf("Invalid txid %s.", prevOut.TxID)
+		}
+		if !ValidateAddress(prevOut.Address) {
+			return nil, fmt.Errorf("Invalid address %s.", prevOut.Address)
+		}
+
+		result[outpointKey(txID, prevOut.Vout)] = *NewTXOutput(prevOut.Amount, prevOut.Address)
+	}
+
+	return result, nil
+}
+
+// prevOutLookup finds outputs in prevOuts first, then in view if there is one.
+func prevOutLookup(prevOuts map[string]TXOutput, view *UTXOView) func(txid []byte, vout int) (TXOutput, bool) {
+	return func(txid []byte, vout int) (TXOutput, bool) {
+		if out, ok := prevOuts[outpointKey(txid, vout)]; ok {
+			return out, true
+		}
+		if view == nil {
+			return TXOutput{}, false
+		}
+
+		return view.FetchOutput(txid, vout)
+	}
+}
+
+// SigningKeys indexes key-pairs by the PubKeyHash of their outputs.
+type SigningKeys map[string]*Wallet
+
+// AddWallets adds the keys of a wallet, locked keys are added too so that
+// their inputs report the wallet is locked.
+func (k SigningKeys) AddWallets(wallets *Wallets) {
+	for _, wallet := range wallets.Wallets {
+		k[string(HashPubKey(wallet.PublicKey))] = wallet
+	}
+}
+
+// AddPrivateKey adds a hex-encoded private key, which may lock outputs to the
+// hash of its compressed or of its x-only public key.
+func (k SigningKeys) AddPrivateKey(keyHex string) error {
+	d, err := hex.DecodeString(keyHex)
+	if err != nil || len(d) != 32 {
+		return errors.New("Invalid private key.")
+	}
+
+	private, public := keyPairFromBytes(d)
+	xOnly := schnorr.SerializePubKey(private.PubKey())
+	k[string(HashPubKey(public))] = &Wallet{private, public, ""}
+	k[string(HashPubKey(xOnly))] = &Wallet{private, xOnly, ""}
+
+	return nil
+}
+
+// SignRawTransaction signs every input of tx whose previous output a key of
+// keys locks, prevOut looks the outputs up. Inputs signed before stay as they
+// are, so that several parties may sign the inputs of their keys in turn.
+// It returns the inputs which are left unsigned and whether tx is complete.
+func SignRawTransaction(tx *Transaction, prevOut func(txid []byte, vout int) (TXOutput, bool), keys SigningKeys) (bool, []RawSignError) {
+	var errs []RawSignError
+	signers := make(map[int]*btcec.PrivateKey)
+
+	for inID, vin := range tx.Vin {
+		fail := func(format string, a ...interface{}) {
+			errs = append(errs, RawSignError{hex.EncodeToString(vin.Txid), vin.Vout, fmt.Sprintf(format, a...)})
+		}
+
+		out, ok := prevOut(vin.Txid, vin.Vout)
+		if !ok {
+			fail("Input not found or already spent")
+			continue
+		}
+
+		wallet := keys[string(out.PubKeyHash)]
+		if wallet == nil {
+			if len(vin.Signature) == 0 {
+				fail("Unable to sign input, the key of %s is missing", PubKeyHashToAddress(out.PubKeyHash))
+			}
+			continue
+		}
+		if wallet.PrivateKey == nil {
+			fail("%s", errWalletLocked)
+			continue
+		}
+
+		tx.Vin[inID].PubKey = wallet.PublicKey
+		signers[inID] = wallet.PrivateKey
+	}
+
+	// the ID covers the public keys, the signatures don't
+	tx.ID = tx.UnsignedHash()
+	for inID, privKey := range signers {
+		tx.SignInput(inID, privKey)
+	}
+
+	return len(errs) == 0 && tx.Verify(), errs
+}
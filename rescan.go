@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var errRescanRunning = errors.New("A rescan is running already, stop it with abortrescan.")
+var errRescanAborted = errors.New("The rescan is aborted.")
+
+// RescanProgress tells how far a rescan of the blocks From to To got.
+type RescanProgress struct {
+	From    int
+	To      int
+	Height  int
+	Started time.Time
+}
+
+// Fraction is the share of the blocks which are scanned.
+func (p RescanProgress) Fraction() float64 {
+	return float64(p.Height-p.From+1) / float64(p.To-p.From+1)
+}
+
+// a node runs one rescan at a time, abortrescan stops it between two blocks
+var rescan *RescanProgress
+var rescanAbort bool
+var rescanLock sync.Mutex
+
+// CurrentRescan returns the progress of the running rescan.
+func CurrentRescan() (RescanProgress, bool) {
+	rescanLock.Lock()
+	defer rescanLock.Unlock()
+
+	if rescan == nil {
+		return RescanProgress{}, false
+	}
+
+	return *rescan, true
+}
+
+// AbortRescan stops the running rescan after the block it is at. It returns
+// whether there is one.
+func AbortRescan() bool {
+	rescanLock.Lock()
+	defer rescanLock.Unlock()
+
+	rescanAbort = rescan != nil
+
+	return rescanAbort
+}
+
+// printRescanProgress reports every tenth of a rescan.
+func printRescanProgress() func(RescanProgress) {
+	reported := 0
+	return func(p RescanProgress) {
+		tenths := int(p.Fraction() * 10)
+		if tenths > reported {
+			reported = tenths
+			fmt.Printf("Rescanning blocks %d to %d: %d%%, at block %d\n", p.From, p.To, tenths*10, p.Height)
+		}
+	}
+}
+
+// walletHistory finds the outputs which the wallet transactions spend.
+type walletHistory struct {
+	bc      *Blockchain
+	tracked map[string]bool
+	txs     map[string]*Transaction
+}
+
+func (h *walletHistory) FetchOutput(txid []byte, vout int) (TXOutput, bool) {
+	tx := h.txs[string(txid)]
+	if tx == nil || vout < 0 || vout >= len(tx.Vout) {
+		return TXOutput{}, false
+	}
+
+	return tx.Vout[vout], true
+}
+
+// add keeps tx with the transactions which its wallet inputs spend, looked up
+// in the chain if the wallet didn't record them.
+func (h *walletHistory) add(tx *Transaction) {
+	h.txs[string(tx.ID)] = tx
+	if tx.IsCoinbase() {
+		return
+	}
+
+	for _, vin := range tx.Vin {
+		if _, ok := h.tracked[string(HashPubKey(vin.PubKey))]; !ok || h.txs[string(vin.Txid)] != nil {
+			continue
+		}
+
+		prevTx, err := h.bc.FindTransaction(vin.Txid)
+		if err == nil {
+			h.txs[string(prevTx.ID)] = &prevTx
+		}
+	}
+}
+
+// RescanWallet rebuilds the wallet transactions of the blocks from to to, the
+// tip if to is negative, for the keys and watch-only addresses of the wallet,
+// so that their history before an import shows. A rescan to the tip also
+// records the transactions of the mempool. report is called after every
+// block. It returns the height scanned up to, which is less than to if
+// AbortRescan stopped it.
+func (bc *Blockchain) RescanWallet(from, to int, report func(RescanProgress)) (int, error) {
+	bestHeight, _ := bc.GetBestHeight()
+	if to < 0 {
+		to = bestHeight
+	}
+	if from < 0 || from > to || to > bestHeight {
+		return from - 1, fmt.Errorf("Invalid range %d to %d, the best height is %d.", from, to, bestHeight)
+	}
+
+	tracked := bc.walletTracked()
+	if len(tracked) == 0 {
+		return from - 1, errors.New("The wallet has no addresses to rescan for.")
+	}
+
+	rescanLock.Lock()
+	if rescan != nil {
+		rescanLock.Unlock()
+		return from - 1, errRescanRunning
+	}
+	rescan = &RescanProgress{from, to, from - 1, time.Now()}
+	rescanAbort = false
+	rescanLock.Unlock()
+
+	defer func() {
+		rescanLock.Lock()
+		rescan = nil
+		rescanLock.Unlock()
+	}()
+
+	history := &walletHistory{bc, tracked, make(map[string]*Transaction)}
+	stale := make(map[int][][]byte)
+	for _, wtx := range bc.WalletTransactions() {
+		tx := wtx.Transaction
+		history.txs[string(tx.ID)] = &tx
+		if wtx.Confirmed() && wtx.Height >= from && wtx.Height <= to {
+			stale[wtx.Height] = append(stale[wtx.Height], tx.ID)
+		}
+	}
+
+	// the iterator goes from the tip backwards
+	var hashes [][]byte
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		if block.Height <= to {
+			hashes = append([][]byte{block.Hash}, hashes...)
+		}
+
+		if block.Height <= from || len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	scanned := from - 1
+	for _, hash := range hashes {
+		rescanLock.Lock()
+		aborted := rescanAbort
+		rescanLock.Unlock()
+		if aborted {
+			return scanned, errRescanAborted
+		}
+
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return scanned, err
+		}
+
+		var wtxs []*WalletTransaction
+		for _, tx := range block.Transactions {
+			history.add(tx)
+			wtx := newWalletTransaction(tx, tracked, history.FetchOutput)
+			if wtx != nil {
+				wtxs = append(wtxs, wtx)
+			}
+		}
+		bc.putWalletBlock(&block, wtxs, stale[block.Height])
+
+		scanned = block.Height
+		rescanLock.Lock()
+		rescan.Height = scanned
+		progress := *rescan
+		rescanLock.Unlock()
+
+		if report != nil {
+			report(progress)
+		}
+	}
+
+	if to == bestHeight {
+		bc.rescanMempool(history)
+	}
+
+	return to, nil
+}
+
+// rescanMempool records the pending transactions which involve the wallet.
+func (bc *Blockchain) rescanMempool(history *walletHistory) {
+	mempoolLock.Lock()
+	defer mempoolLock.Unlock()
+
+	// a pending transaction may spend the outputs of any other
+	var pending []*Transaction
+	for id := range mempool {
+		tx := mempool[id]
+		history.txs[string(tx.ID)] = &tx
+		pending = append(pending, &tx)
+	}
+	for _, tx := range pending {
+		history.add(tx)
+	}
+
+	var wtxs []*WalletTransaction
+	for _, tx := range pending {
+		wtx := newWalletTransaction(tx, history.tracked, history.FetchOutput)
+		if wtx != nil {
+			wtx.Time = time.Now().Unix()
+			wtxs = append(wtxs, wtx)
+		}
+	}
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(walletTxBucket))
+		if err != nil {
+			return err
+		}
+
+		return putWalletTxs(b, wtxs)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
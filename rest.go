@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// at most this many outpoints may be queried by one getutxos request
+const maxRESTOutpoints = 15
+
+// at most this many headers are returned by one headers request
+const maxRESTHeaders = 2000
+
+type restHandler func(args []string, checkMempool bool) (interface{}, []byte, error)
+
+// RESTError carries the HTTP status of a failed REST request.
+type RESTError struct {
+	Status  int
+	Message string
+}
+
+func (e *RESTError) Error() string {
+	return e.Message
+}
+
+type ChainInfoJSON struct {
+	Chain         string `json:"chain"`
+	Blocks        int    `json:"blocks"`
+	BestBlockHash string `json:"bestblockhash"`
+	Time          int64  `json:"time"`
+	TargetBits    int    `json:"targetbits"`
+	MempoolSize   int    `json:"mempoolsize"`
+}
+
+type MempoolInfoJSON struct {
+	Size  int `json:"size"`
+	Bytes int `json:"bytes"`
+}
+
+type UTXOJSON struct {
+	TxID    string `json:"txid"`
+	N       int    `json:"n"`
+	Value   int    `json:"value"`
+	Address string `json:"address"`
+}
+
+// GetUTXOsJSON reports for every queried outpoint whether it is unspent
+// in bitmap, and the unspent outputs in utxos.
+type GetUTXOsJSON struct {
+	ChainHeight  int        `json:"chainHeight"`
+	ChainTipHash string     `json:"chaintipHash"`
+	Bitmap       string     `json:"bitmap"`
+	UTXOs        []UTXOJSON `json:"utxos"`
+}
+
+// EnableREST serves the read-only REST interface without authentication:
+//
+//	/rest/block/<hash>.<json|bin|hex>
+//	/rest/headers/<count>/<hash>.<json|bin|hex>
+//	/rest/tx/<txid>.<json|bin|hex>
+//	/rest/getutxos[/checkmempool]/<txid>-<n>/....<json|bin|hex>
+//	/rest/chaininfo.<json|bin|hex>
+//	/rest/mempool/info.<json|bin|hex>
+//	/rest/mempool/contents.<json|bin|hex>
+//
+// bin is the gob encoding used on the wire and in the database.
+func (s *RPCServer) EnableREST() {
+	s.Mux.HandleFunc("/rest/", handleREST)
+	fmt.Println("REST interface is enabled")
+}
+
+func handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "REST requests must be GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/rest/")
+	dot := strings.LastIndex(path, ".")
+	if dot < 0 {
+		http.Error(w, "output format not found (available: json, bin, hex)", http.StatusNotFound)
+		return
+	}
+	format := path[dot+1:]
+	parts := strings.Split(path[:dot], "/")
+
+	var handler restHandler
+	switch parts[0] {
+	case "block":
+		handler = restBlock
+	case "headers":
+		handler = restHeaders
+	case "tx":
+		handler = restTx
+	case "getutxos":
+		handler = restGetUTXOs
+	case "chaininfo":
+		handler = restChainInfo
+	case "mempool":
+		handler = restMempool
+	default:
+		http.Error(w, "unknown REST resource", http.StatusNotFound)
+		return
+	}
+
+	args := parts[1:]
+	checkMempool := len(args) > 0 && args[0] == "checkmempool"
+	if checkMempool {
+		args = args[1:]
+	}
+
+	if getLocalChain() == nil {
+		http.Error(w, "the node doesn't have a blockchain yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, binary, err := handler(args, checkMempool)
+	if err != nil {
+		status := http.StatusBadRequest
+		if restErr, ok := err.(*RESTError); ok {
+			status = restErr.Status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(result)
+	case "bin":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, err = w.Write(binary)
+	case "hex":
+		w.Header().Set("Content-Type", "text/plain")
+		_, err = fmt.Fprintln(w, hex.EncodeToString(binary))
+	default:
+		http.Error(w, "output format not found (available: json, bin, hex)", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to write REST response: %s\n", err)
+	}
+}
+
+func restArgs(args []string, n int) error {
+	if len(args) != n {
+		return &RESTError{http.StatusBadRequest, "invalid URI format"}
+	}
+
+	return nil
+}
+
+func restHash(s string) ([]byte, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil || len(hash) == 0 {
+		return nil, &RESTError{http.StatusBadRequest, "invalid hash: " + s}
+	}
+
+	return hash, nil
+}
+
+func restBlock(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if err := restArgs(args, 1); err != nil {
+		return nil, nil, err
+	}
+
+	hash, err := restHash(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bc := getLocalChain()
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return nil, nil, &RESTError{http.StatusNotFound, args[0] + " not found"}
+	}
+
+	bestHeight, _ := bc.GetBestHeight()
+	return NewBlockJSON(&block, bestHeight, true), block.Serialize(), nil
+}
+
+func restHeaders(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if err := restArgs(args, 2); err != nil {
+		return nil, nil, err
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 || count > maxRESTHeaders {
+		return nil, nil, &RESTError{http.StatusBadRequest, fmt.Sprintf("header count is invalid or out of acceptable range (1-%d)", maxRESTHeaders)}
+	}
+
+	hash, err := restHash(args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers, err := getLocalChain().GetHeaders(hash, count)
+	if err != nil {
+		return nil, nil, &RESTError{http.StatusNotFound, args[1] + " not found"}
+	}
+
+	result := []map[string]interface{}{}
+	for _, header := range headers {
+		result = append(result, map[string]interface{}{
+			"hash":              hex.EncodeToString(header.Hash),
+			"height":            header.Height,
+			"previousblockhash": hex.EncodeToString(header.PrevBlockHash),
+			"merkleroot":        hex.EncodeToString(header.MerkleRoot),
+			"time":              header.Timestamp,
+			"nonce":             header.Nonce,
+		})
+	}
+
+	return result, gobEncode(headers), nil
+}
+
+func restTx(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if err := restArgs(args, 1); err != nil {
+		return nil, nil, err
+	}
+
+	txID, err := restHash(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, ok := mempoolTransaction(hex.EncodeToString(txID))
+	if !ok {
+		tx, err = getLocalChain().FindTransaction(txID)
+		if err != nil {
+			return nil, nil, &RESTError{http.StatusNotFound, args[0] + " not found"}
+		}
+	}
+
+	return NewTxJSON(&tx), tx.Serialize(), nil
+}
+
+func restGetUTXOs(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if len(args) == 0 || len(args) > maxRESTOutpoints {
+		return nil, nil, &RESTError{http.StatusBadRequest, fmt.Sprintf("between 1 and %d outpoints are required", maxRESTOutpoints)}
+	}
+
+	bc := getLocalChain()
+	utxo := UTXOSet{bc}
+
+	view := NewUTXOView(utxo)
+	if checkMempool {
+		mempoolLock.Lock()
+		view = mempoolView(utxo)
+		mempoolLock.Unlock()
+	}
+
+	height, tipHash := bc.GetBestHeight()
+	result := GetUTXOsJSON{ChainHeight: height, ChainTipHash: hex.EncodeToString(tipHash), UTXOs: []UTXOJSON{}}
+	var outputs []TXOutput
+
+	for _, arg := range args {
+		dash := strings.LastIndex(arg, "-")
+		if dash < 0 {
+			return nil, nil, &RESTError{http.StatusBadRequest, "parse error: " + arg}
+		}
+
+		txID, err := restHash(arg[:dash])
+		if err != nil {
+			return nil, nil, err
+		}
+		n, err := strconv.Atoi(arg[dash+1:])
+		if err != nil {
+			return nil, nil, &RESTError{http.StatusBadRequest, "parse error: " + arg}
+		}
+
+		out, ok := view.FetchOutput(txID, n)
+		if !ok {
+			result.Bitmap += "0"
+			continue
+		}
+
+		result.Bitmap += "1"
+		result.UTXOs = append(result.UTXOs, UTXOJSON{arg[:dash], n, out.Value, PubKeyHashToAddress(out.PubKeyHash)})
+		outputs = append(outputs, out)
+	}
+
+	binary := gobEncode(struct {
+		ChainHeight  int
+		ChainTipHash []byte
+		Bitmap       string
+		UTXOs        []TXOutput
+	}{height, tipHash, result.Bitmap, outputs})
+
+	return result, binary, nil
+}
+
+func restChainInfo(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if err := restArgs(args, 0); err != nil {
+		return nil, nil, err
+	}
+
+	bc := getLocalChain()
+	height, tipHash := bc.GetBestHeight()
+	tip, err := bc.GetBlock(tipHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := ChainInfoJSON{
+		Chain:         "main",
+		Blocks:        height,
+		BestBlockHash: hex.EncodeToString(tipHash),
+		Time:          tip.Timestamp,
+		TargetBits:    targetBits,
+		MempoolSize:   mempoolSize(),
+	}
+
+	return result, gobEncode(result), nil
+}
+
+func restMempool(args []string, checkMempool bool) (interface{}, []byte, error) {
+	if err := restArgs(args, 1); err != nil {
+		return nil, nil, err
+	}
+
+	txs := mempoolTransactions()
+
+	switch args[0] {
+	case "info":
+		result := MempoolInfoJSON{Size: len(txs)}
+		for _, tx := range txs {
+			result.Bytes += len(tx.Serialize())
+		}
+		return result, gobEncode(result), nil
+
+	case "contents":
+		result := map[string]TxJSON{}
+		var contents []Transaction
+		for _, tx := range txs {
+			result[hex.EncodeToString(tx.ID)] = NewTxJSON(tx)
+			contents = append(contents, *tx)
+		}
+		return result, gobEncode(contents), nil
+	}
+
+	return nil, nil, &RESTError{http.StatusNotFound, "unknown mempool resource"}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// JSON representations of blocks and transactions shared by the RPC and HTTP interfaces.
+
+type BlockJSON struct {
+	Hash              string        `json:"hash"`
+	Height            int           `json:"height"`
+	Confirmations     int           `json:"confirmations"`
+	PreviousBlockHash string        `json:"previousblockhash"`
+	MerkleRoot        string        `json:"merkleroot"`
+	Time              int64         `json:"time"`
+	Nonce             int           `json:"nonce"`
+	Size              int           `json:"size"`
+	Tx                []interface{} `json:"tx"`
+}
+
+type TxJSON struct {
+	TxID          string     `json:"txid"`
+	Size          int        `json:"size"`
+	Vin           []VinJSON  `json:"vin"`
+	Vout          []VoutJSON `json:"vout"`
+	BlockHash     string     `json:"blockhash,omitempty"`
+	Confirmations int        `json:"confirmations,omitempty"`
+	Hex           string     `json:"hex,omitempty"`
+}
+
+// TxInfoJSON locates a transaction, the height and position are -1 in the mempool.
+type TxInfoJSON struct {
+	TxJSON
+	BlockHeight int `json:"blockheight"`
+	Position    int `json:"position"`
+}
+
+type VinJSON struct {
+	TxID      string `json:"txid,omitempty"`
+	Vout      int    `json:"vout"`
+	Coinbase  string `json:"coinbase,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	PubKey    string `json:"pubkey,omitempty"`
+}
+
+type VoutJSON struct {
+	Value      int    `json:"value"`
+	N          int    `json:"n"`
+	PubKeyHash string `json:"pubkeyhash"`
+	Address    string `json:"address"`
+}
+
+// NewBlockJSON lists the txids of the block, or the decoded transactions if verbose is set.
+func NewBlockJSON(block *Block, bestHeight int, verbose bool) BlockJSON {
+	result := BlockJSON{
+		Hash:              hex.EncodeToString(block.Hash),
+		Height:            block.Height,
+		Confirmations:     bestHeight - block.Height + 1,
+		PreviousBlockHash: hex.EncodeToString(block.PrevBlockHash),
+		MerkleRoot:        hex.EncodeToString(block.HashTransactions()),
+		Time:              block.Timestamp,
+		Nonce:             block.Nonce,
+		Size:              len(block.Serialize()),
+		Tx:                []interface{}{},
+	}
+
+	for _, tx := range block.Transactions {
+		if verbose {
+			result.Tx = append(result.Tx, NewTxJSON(tx))
+		} else {
+			result.Tx = append(result.Tx, hex.EncodeToString(tx.ID))
+		}
+	}
+
+	return result
+}
+
+func NewTxJSON(tx *Transaction) TxJSON {
+	result := TxJSON{
+		TxID: hex.EncodeToString(tx.ID),
+		Size: len(tx.Serialize()),
+		Vin:  []VinJSON{},
+		Vout: []VoutJSON{},
+	}
+
+	for _, vin := range tx.Vin {
+		if tx.IsCoinbase() {
+			result.Vin = append(result.Vin, VinJSON{Vout: vin.Vout, Coinbase: hex.EncodeToString(vin.PubKey)})
+			continue
+		}
+
+		result.Vin = append(result.Vin, VinJSON{
+			TxID:      hex.EncodeToString(vin.Txid),
+			Vout:      vin.Vout,
+			Signature: hex.EncodeToString(vin.Signature),
+			PubKey:    hex.EncodeToString(vin.PubKey),
+		})
+	}
+
+	for i, vout := range tx.Vout {
+		result.Vout = append(result.Vout, VoutJSON{
+			Value:      vout.Value,
+			N:          i,
+			PubKeyHash: hex.EncodeToString(vout.PubKeyHash),
+			Address:    PubKeyHashToAddress(vout.PubKeyHash),
+		})
+	}
+
+	return result
+}
+
+func NewTxInfoJSON(bc *Blockchain, block *Block, position int) TxInfoJSON {
+	tx := block.Transactions[position]
+	bestHeight, _ := bc.GetBestHeight()
+
+	result := TxInfoJSON{TxJSON: NewTxJSON(tx), BlockHeight: block.Height, Position: position}
+	result.BlockHash = hex.EncodeToString(block.Hash)
+	result.Confirmations = bestHeight - block.Height + 1
+	result.Hex = hex.EncodeToString(tx.Serialize())
+
+	return result
+}
+
+// AddressEventJSON is an entry of getaddresshistory and getaddressutxos.
+type AddressEventJSON struct {
+	Type     string `json:"type"`
+	Height   int    `json:"height"`
+	TxID     string `json:"txid"`
+	Index    int    `json:"index"`
+	Value    int    `json:"value"`
+	PrevTxID string `json:"prevtxid,omitempty"`
+	PrevVout int    `json:"prevvout,omitempty"`
+}
+
+func NewAddressEventJSON(e AddressEvent) AddressEventJSON {
+	result := AddressEventJSON{Type: "funding", Height: e.Height, TxID: hex.EncodeToString(e.TxID), Index: e.Index, Value: e.Value}
+	if e.Spending {
+		result.Type = "spending"
+		result.PrevTxID = hex.EncodeToString(e.PrevTxID)
+		result.PrevVout = e.PrevVout
+	}
+
+	return result
+}
+
+type CreateWalletJSON struct {
+	Mnemonic string `json:"mnemonic"`
+	Address  string `json:"address"`
+}
+
+// SendManyJSON reports a sendmany transaction, Hex is only set by a dry run.
+type SendManyJSON struct {
+	TxID       string `json:"txid"`
+	Recipients int    `json:"recipients"`
+	Total      int    `json:"total"`
+	Fee        int    `json:"fee"`
+	Change     int    `json:"change"`
+	Hex        string `json:"hex,omitempty"`
+}
+
+type RestoreWalletJSON struct {
+	Used      int      `json:"used"`
+	Addresses []string `json:"addresses"`
+}
+
+func NewSendManyJSON(tx *Transaction, selection *CoinSelection, recipients int) SendManyJSON {
+	return SendManyJSON{
+		TxID:       hex.EncodeToString(tx.ID),
+		Recipients: recipients,
+		Total:      selection.Value - selection.Fee - selection.Change,
+		Fee:        selection.Fee,
+		Change:     selection.Change,
+	}
+}
+
+// PSBTJSON is the result of signpsbt and finalizepsbt. Complete tells
+// whether every input has its signature, Signed is the number signed by signpsbt.
+type PSBTJSON struct {
+	PSBT     string `json:"psbt"`
+	Signed   int    `json:"signed,omitempty"`
+	Complete bool   `json:"complete"`
+}
+
+type KeyDerivationJSON struct {
+	PubKey      string `json:"pubkey"`
+	Fingerprint string `json:"fingerprint"`
+	Path        string `json:"path"`
+}
+
+type PSBTInputJSON struct {
+	TxID        string              `json:"txid"`
+	Vout        int                 `json:"vout"`
+	Value       *int                `json:"value,omitempty"`
+	Address     string              `json:"address,omitempty"`
+	PartialSigs map[string]string   `json:"partial_signatures,omitempty"`
+	Derivations []KeyDerivationJSON `json:"derivations,omitempty"`
+	Final       bool                `json:"final"`
+}
+
+type PSBTOutputJSON struct {
+	Value       int                 `json:"value"`
+	Address     string              `json:"address"`
+	Derivations []KeyDerivationJSON `json:"derivations,omitempty"`
+}
+
+// DecodedPSBTJSON is the result of decodepsbt, Fee is unknown until every
+// previous output is.
+type DecodedPSBTJSON struct {
+	Inputs   []PSBTInputJSON  `json:"inputs"`
+	Outputs  []PSBTOutputJSON `json:"outputs"`
+	Fee      *int             `json:"fee,omitempty"`
+	Complete bool             `json:"complete"`
+}
+
+func newKeyDerivationsJSON(derivations []KeyDerivation) []KeyDerivationJSON {
+	var result []KeyDerivationJSON
+	for _, derivation := range derivations {
+		result = append(result, KeyDerivationJSON{
+			PubKey:      hex.EncodeToString(derivation.PubKey),
+			Fingerprint: hex.EncodeToString(derivation.Fingerprint),
+			Path:        derivation.Path,
+		})
+	}
+
+	return result
+}
+
+func NewDecodedPSBTJSON(p *PSBT) DecodedPSBTJSON {
+	result := DecodedPSBTJSON{Inputs: []PSBTInputJSON{}, Outputs: []PSBTOutputJSON{}, Complete: p.IsSigned()}
+
+	for i, in := range p.Inputs {
+		vin := p.Tx.Vin[i]
+		input := PSBTInputJSON{
+			TxID:        hex.EncodeToString(vin.Txid),
+			Vout:        vin.Vout,
+			Derivations: newKeyDerivationsJSON(in.Derivations),
+			Final:       in.FinalSignature != nil,
+		}
+		if in.PrevOut != nil {
+			value := in.PrevOut.Value
+			input.Value = &value
+			input.Address = PubKeyHashToAddress(in.PrevOut.PubKeyHash)
+		}
+		if len(in.PartialSigs) > 0 {
+			input.PartialSigs = make(map[string]string)
+			for _, sig := range in.PartialSigs {
+				input.PartialSigs[hex.EncodeToString(sig.PubKey)] = hex.EncodeToString(sig.Signature)
+			}
+		}
+		result.Inputs = append(result.Inputs, input)
+	}
+
+	for i, vout := range p.Tx.Vout {
+		result.Outputs = append(result.Outputs, PSBTOutputJSON{
+			Value:       vout.Value,
+			Address:     PubKeyHashToAddress(vout.PubKeyHash),
+			Derivations: newKeyDerivationsJSON(p.Outputs[i].Derivations),
+		})
+	}
+
+	if fee, ok := p.Fee(); ok {
+		result.Fee = &fee
+	}
+
+	return result
+}
+
+// WalletTxJSON is an entry of listtransactions. Amount is what the
+// transaction adds to the wallet, negative if it pays out.
+type WalletTxJSON struct {
+	TxID          string `json:"txid"`
+	Category      string `json:"category"`
+	Amount        int    `json:"amount"`
+	Fee           int    `json:"fee,omitempty"`
+	Confirmations int    `json:"confirmations"`
+	BlockHash     string `json:"blockhash,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	Time          int64  `json:"time"`
+	WatchOnly     bool   `json:"watchonly,omitempty"`
+}
+
+func NewWalletTxJSON(wtx WalletTransaction, bestHeight int) WalletTxJSON {
+	result := WalletTxJSON{
+		TxID:      hex.EncodeToString(wtx.Transaction.ID),
+		Amount:    wtx.Amount(),
+		Fee:       wtx.Fee,
+		Time:      wtx.Time,
+		WatchOnly: wtx.WatchOnly,
+	}
+
+	switch {
+	case wtx.Transaction.IsCoinbase():
+		result.Category = "generate"
+	case result.Amount < 0:
+		result.Category = "send"
+	default:
+		result.Category = "receive"
+	}
+
+	if wtx.Confirmed() {
+		result.BlockHash = hex.EncodeToString(wtx.BlockHash)
+		result.Height = wtx.Height
+		result.Confirmations = bestHeight - wtx.Height + 1
+	}
+
+	return result
+}
+
+type WalletInfoJSON struct {
+	Keys                        int  `json:"keys"`
+	WatchOnly                   int  `json:"watchonly"`
+	TxCount                     int  `json:"txcount"`
+	Balance                     int  `json:"balance"`
+	UnconfirmedBalance          int  `json:"unconfirmed_balance"`
+	WatchOnlyBalance            int  `json:"watchonly_balance"`
+	WatchOnlyUnconfirmedBalance int  `json:"watchonly_unconfirmed_balance"`
+	HD                          bool `json:"hd"`
+	Encrypted                   bool `json:"encrypted"`
+	Locked                      bool `json:"locked"`
+	// set while a rescan runs
+	Scanning *ScanningJSON `json:"scanning,omitempty"`
+}
+
+type ScanningJSON struct {
+	Height   int     `json:"height"`
+	Duration int     `json:"duration"`
+	Progress float64 `json:"progress"`
+}
+
+func NewWalletInfoJSON(wallets *Wallets, wtxs []WalletTransaction) WalletInfoJSON {
+	balance := NewWalletBalance(wtxs, wallets.TrackedPubKeyHashes())
+
+	// the seed of a locked wallet is sealed, but its keys have paths
+	hd := wallets.IsHD()
+	for _, wallet := range wallets.Wallets {
+		hd = hd || wallet.Path != ""
+	}
+
+	var scanning *ScanningJSON
+	if p, ok := CurrentRescan(); ok {
+		scanning = &ScanningJSON{p.Height, int(time.Since(p.Started).Seconds()), p.Fraction()}
+	}
+
+	return WalletInfoJSON{
+		Keys:                        len(wallets.Wallets),
+		WatchOnly:                   len(wallets.WatchOnly),
+		TxCount:                     len(wtxs),
+		Balance:                     balance.Confirmed,
+		UnconfirmedBalance:          balance.Unconfirmed,
+		WatchOnlyBalance:            balance.WatchOnlyConfirmed,
+		WatchOnlyUnconfirmedBalance: balance.WatchOnlyUnconfirmed,
+		HD:                          hd,
+		Encrypted:                   wallets.IsEncrypted(),
+		Locked:                      wallets.IsLocked(),
+		Scanning:                    scanning,
+	}
+}
+
+// RescanJSON is the result of rescanblockchain.
+type RescanJSON struct {
+	StartHeight int  `json:"start_height"`
+	StopHeight  int  `json:"stop_height"`
+	Aborted     bool `json:"aborted,omitempty"`
+}
+
+// listWalletTransactions returns count entries of wtxs before the last skip,
+// the oldest first.
+func listWalletTransactions(wtxs []WalletTransaction, count, skip, bestHeight int) []WalletTxJSON {
+	end := len(wtxs) - skip
+	if end < 0 {
+		end = 0
+	}
+	start := end - count
+	if start < 0 {
+		start = 0
+	}
+
+	result := []WalletTxJSON{}
+	for _, wtx := range wtxs[start:end] {
+		result = append(result, NewWalletTxJSON(wtx, bestHeight))
+	}
+
+	return result
+}
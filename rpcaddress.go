@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+func init() {
+	rpcHandlers["getaddresshistory"] = rpcGetAddressHistory
+	rpcHandlers["getaddressutxos"] = rpcGetAddressUTXOs
+}
+
+// getaddresshistory "address" lists the funding and spending events of address.
+func rpcGetAddressHistory(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	return rpcAddressEvents(params, (*Blockchain).AddressHistory)
+}
+
+// getaddressutxos "address" lists the unspent outputs of address.
+func rpcGetAddressUTXOs(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	return rpcAddressEvents(params, (*Blockchain).AddressUTXOs)
+}
+
+func rpcAddressEvents(params []json.RawMessage, lookup func(*Blockchain, []byte) ([]AddressEvent, error)) (interface{}, error) {
+	var address string
+	err := parseParams(params, 1, &address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidateAddress(address) {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid address")
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := lookup(bc, AddressToPubKeyHash(address))
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+
+	result := []AddressEventJSON{}
+	for _, e := range events {
+		result = append(result, NewAddressEventJSON(e))
+	}
+
+	return result, nil
+}
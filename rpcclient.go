@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// RPCClient calls the JSON-RPC server of a running node.
+type RPCClient struct {
+	URL      string
+	User     string
+	Password string
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// Call invokes method with positional params and decodes the result into result, if not nil.
+func (c *RPCClient) Call(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.SetBasicAuth(c.User, c.Password)
+
+	httpResponse, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode == http.StatusUnauthorized {
+		return errors.New("RPC authentication failed, check the user and password")
+	}
+
+	var response rpcResponse
+	err = json.NewDecoder(httpResponse.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("Invalid RPC response: %s", err)
+	}
+
+	if response.Error != nil {
+		return response.Error
+	}
+
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+
+	return nil
+}
+
+// rpcFlags selects between a running node and direct access to the files of NODE_ID.
+// The defaults come from the RPC_CONNECT, RPC_PORT, RPC_USER and RPC_PASSWORD env. vars.
+type rpcFlags struct {
+	connect  *string
+	port     *string
+	user     *string
+	password *string
+	direct   *bool
+}
+
+func addRPCFlags(fs *flag.FlagSet) *rpcFlags {
+	connect := os.Getenv("RPC_CONNECT")
+	if connect == "" {
+		connect = "localhost"
+	}
+
+	return &rpcFlags{
+		connect:  fs.String("rpcconnect", connect, "Host of the running node"),
+		port:     fs.String("rpcport", os.Getenv("RPC_PORT"), "RPC port of the running node"),
+		user:     fs.String("rpcuser", os.Getenv("RPC_USER"), "RPC user of the running node"),
+		password: fs.String("rpcpassword", os.Getenv("RPC_PASSWORD"), "RPC password of the running node"),
+		direct:   fs.Bool("direct", false, "Open the blockchain and wallet files directly instead of using RPC"),
+	}
+}
+
+// client returns nil if the command should access the files directly.
+func (f *rpcFlags) client() *RPCClient {
+	if *f.direct || *f.port == "" {
+		return nil
+	}
+
+	return &RPCClient{fmt.Sprintf("http://%s:%s/", *f.connect, *f.port), *f.user, *f.password}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+func init() {
+	rpcHandlers["combinepsbt"] = rpcCombinePSBT
+	rpcHandlers["createpsbt"] = rpcCreatePSBT
+	rpcHandlers["decodepsbt"] = rpcDecodePSBT
+	rpcHandlers["extractpsbt"] = rpcExtractPSBT
+	rpcHandlers["finalizepsbt"] = rpcFinalizePSBT
+	rpcHandlers["signpsbt"] = rpcSignPSBT
+	rpcHandlers["updatepsbt"] = rpcUpdatePSBT
+}
+
+func parsePSBTParam(s string) (*PSBT, error) {
+	p, err := ParsePSBT(s)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "PSBT decode failed: %s", err)
+	}
+
+	return p, nil
+}
+
+// createpsbt [{"txid": ..., "vout": ...}, ...] payments takes the arguments of createrawtransaction.
+func rpcCreatePSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var inputs []RawInput
+	var outputs json.RawMessage
+	err := parseParams(params, 2, &inputs, &outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := ParsePayments(outputs)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	tx, err := CreateRawTransaction(inputs, payments)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	p, err := NewPSBT(tx)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	return p.Serialize(), nil
+}
+
+// updatepsbt "psbt" adds the previous outputs from the chain and the mempool
+// and the derivations of the keys of the wallet.
+func rpcUpdatePSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbt string
+	err := parseParams(params, 1, &psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := parsePSBTParam(psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	var view *UTXOView
+	if bc := getLocalChain(); bc != nil {
+		mempoolLock.Lock()
+		view = mempoolView(UTXOSet{bc})
+		mempoolLock.Unlock()
+	}
+
+	// a node without a wallet still knows the previous outputs
+	wallets, _ := rpcWallets(s.nodeID)
+	p.Update(prevOutLookup(nil, view), wallets)
+
+	return p.Serialize(), nil
+}
+
+// signpsbt "psbt" (["privkey", ...]) signs the inputs with the wallet of the
+// node, or with the given private keys only if there are any.
+func rpcSignPSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbt string
+	var privKeys []string
+	err := parseParams(params, 1, &psbt, &privKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := parsePSBTParam(psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(SigningKeys)
+	if len(privKeys) > 0 {
+		for _, privKey := range privKeys {
+			err := keys.AddPrivateKey(privKey)
+			if err != nil {
+				return nil, newRPCError(rpcInvalidAddress, "%s", err)
+			}
+		}
+	} else {
+		wallets, err := rpcWallets(s.nodeID)
+		if err != nil {
+			return nil, newRPCError(rpcMiscError, "The node doesn't have a wallet")
+		}
+		if wallets.IsLocked() {
+			return nil, newRPCError(rpcWalletUnlockNeeded, "%s", errWalletLocked)
+		}
+		keys.AddWallets(wallets)
+		keys.AddDerivations(wallets, p)
+	}
+
+	signed := p.Sign(keys)
+
+	return PSBTJSON{p.Serialize(), signed, p.IsSigned()}, nil
+}
+
+// combinepsbt ["psbt", ...] merges the signatures and data of PSBTs of one transaction.
+func rpcCombinePSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbts []string
+	err := parseParams(params, 1, &psbts)
+	if err != nil {
+		return nil, err
+	}
+	if len(psbts) == 0 {
+		return nil, newRPCError(rpcInvalidParams, "There are no PSBTs to combine")
+	}
+
+	combined, err := parsePSBTParam(psbts[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, psbt := range psbts[1:] {
+		p, err := parsePSBTParam(psbt)
+		if err != nil {
+			return nil, err
+		}
+
+		err = combined.Combine(p)
+		if err != nil {
+			return nil, newRPCError(rpcInvalidParams, "%s", err)
+		}
+	}
+
+	return combined.Serialize(), nil
+}
+
+// finalizepsbt "psbt" puts the signatures of the inputs in place.
+func rpcFinalizePSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbt string
+	err := parseParams(params, 1, &psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := parsePSBTParam(psbt)
+	if err != nil {
+		return nil, err
+	}
+	complete := p.Finalize()
+
+	return PSBTJSON{PSBT: p.Serialize(), Complete: complete}, nil
+}
+
+// extractpsbt "psbt" returns the signed transaction of a finalized PSBT as hex for sendrawtransaction.
+func rpcExtractPSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbt string
+	err := parseParams(params, 1, &psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := parsePSBTParam(psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.Extract()
+	if err != nil {
+		return nil, newRPCError(rpcVerifyRejected, "%s", err)
+	}
+
+	return hex.EncodeToString(tx.Serialize()), nil
+}
+
+func rpcDecodePSBT(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var psbt string
+	err := parseParams(params, 1, &psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := parsePSBTParam(psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDecodedPSBTJSON(p), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+func init() {
+	rpcHandlers["createrawtransaction"] = rpcCreateRawTransaction
+	rpcHandlers["decoderawtransaction"] = rpcDecodeRawTransaction
+	rpcHandlers["signrawtransaction"] = rpcSignRawTransaction
+}
+
+// createrawtransaction [{"txid": ..., "vout": ...}, ...] payments returns an
+// unsigned transaction spending the inputs, payments are the outputs as sendmany takes them.
+func rpcCreateRawTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var inputs []RawInput
+	var outputs json.RawMessage
+	err := parseParams(params, 2, &inputs, &outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := ParsePayments(outputs)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	tx, err := CreateRawTransaction(inputs, payments)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	return hex.EncodeToString(tx.Serialize()), nil
+}
+
+// decoderawtransaction "hex" returns the transaction as getrawtransaction does verbosely.
+func rpcDecodeRawTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var txHex string
+	err := parseParams(params, 1, &txHex)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DecodeRawTransaction(txHex)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "TX decode failed: %s", err)
+	}
+
+	return NewTxJSON(tx), nil
+}
+
+// signrawtransaction "hex" (prevtxs ["privkey", ...]) signs the inputs with the
+// wallet of the node, or with the given private keys only if there are any.
+// prevtxs are the outputs which the inputs spend, [{"txid": ..., "vout": ...,
+// "address": ..., "amount": ...}, ...], looked up in the chain and the mempool otherwise.
+func rpcSignRawTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var txHex string
+	var prevTxs json.RawMessage
+	var privKeys []string
+	err := parseParams(params, 1, &txHex, &prevTxs, &privKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DecodeRawTransaction(txHex)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "TX decode failed: %s", err)
+	}
+
+	prevOuts := make(map[string]TXOutput)
+	if len(prevTxs) > 0 && string(prevTxs) != "null" {
+		prevOuts, err = ParsePrevOuts(prevTxs)
+		if err != nil {
+			return nil, newRPCError(rpcInvalidParams, "Invalid prevtxs: %s", err)
+		}
+	}
+
+	keys := make(SigningKeys)
+	if len(privKeys) > 0 {
+		for _, privKey := range privKeys {
+			err := keys.AddPrivateKey(privKey)
+			if err != nil {
+				return nil, newRPCError(rpcInvalidAddress, "%s", err)
+			}
+		}
+	} else {
+		wallets, err := rpcWallets(s.nodeID)
+		if err != nil {
+			return nil, newRPCError(rpcMiscError, "The node doesn't have a wallet")
+		}
+		keys.AddWallets(wallets)
+	}
+
+	var view *UTXOView
+	if bc := getLocalChain(); bc != nil {
+		mempoolLock.Lock()
+		view = mempoolView(UTXOSet{bc})
+		mempoolLock.Unlock()
+	}
+
+	complete, errs := SignRawTransaction(tx, prevOutLookup(prevOuts, view), keys)
+
+	return SignRawJSON{hex.EncodeToString(tx.Serialize()), complete, errs}, nil
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// application errors as in bitcoind
+	rpcMiscError       = -1
+	rpcInvalidAddress  = -5
+	rpcNotFound        = -5
+	rpcVerifyRejected  = -26
+	rpcClientNotReady  = -9
+	rpcDeserialization = -22
+	// wallet errors as in bitcoind
+	rpcWalletError               = -4
+	rpcWalletUnlockNeeded        = -13
+	rpcWalletPassphraseIncorrect = -14
+	rpcWalletWrongEncState       = -15
+)
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+	ID      json.RawMessage   `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func newRPCError(code int, format string, a ...interface{}) *rpcError {
+	return &rpcError{code, fmt.Sprintf(format, a...)}
+}
+
+type rpcHandler func(s *RPCServer, params []json.RawMessage) (interface{}, error)
+
+// handlers of the other files register themselves in init
+var rpcHandlers = map[string]rpcHandler{
+	"createblockchain":   rpcCreateBlockchain,
+	"getbestblockhash":   rpcGetBestBlockHash,
+	"getblock":           rpcGetBlock,
+	"getblockcount":      rpcGetBlockCount,
+	"getblockhash":       rpcGetBlockHash,
+	"getbalance":         rpcGetBalance,
+	"getmempoolinfo":     rpcGetMempoolInfo,
+	"getmininginfo":      rpcGetMiningInfo,
+	"getpeerinfo":        rpcGetPeerInfo,
+	"getrawmempool":      rpcGetRawMempool,
+	"getrawtransaction":  rpcGetRawTransaction,
+	"gettransaction":     rpcGetTransaction,
+	"reindexutxo":        rpcReindexUTXO,
+	"sendrawtransaction": rpcSendRawTransaction,
+	"setmining":          rpcSetMining,
+	"stop":               rpcStop,
+}
+
+type RPCConfig struct {
+	Port     string
+	User     string
+	Password string
+	// serve the unauthenticated REST interface under /rest/ as well
+	REST bool
+	// serve the unauthenticated block explorer under /explorer/ as well
+	Explorer bool
+	// serve the unauthenticated Prometheus metrics under /metrics as well
+	Metrics bool
+}
+
+// RPCServer serves JSON-RPC 2.0 requests with HTTP basic authentication.
+// Other HTTP interfaces of the node are registered on Mux.
+type RPCServer struct {
+	nodeID   string
+	user     string
+	password string
+	Mux      *http.ServeMux
+}
+
+func NewRPCServer(nodeID, user, password string) *RPCServer {
+	s := &RPCServer{nodeID: nodeID, user: user, password: password, Mux: http.NewServeMux()}
+	s.Mux.HandleFunc("/", s.handleRPC)
+	s.Mux.HandleFunc("/events", s.handleEvents)
+
+	return s
+}
+
+// Start listens on localhost:port in the background.
+func (s *RPCServer) Start(port string) {
+	address := fmt.Sprintf("localhost:%s", port)
+	fmt.Printf("RPC server listens on %s\n", address)
+
+	go func() {
+		err := http.ListenAndServe(address, s.Mux)
+		if err != nil {
+			log.Panic(err)
+		}
+	}()
+}
+
+func (s *RPCServer) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+
+	return userOK && passwordOK
+}
+
+func (s *RPCServer) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request rpcRequest
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeRPCResponse(w, nil, nil, newRPCError(rpcParseError, "Parse error: %s", err))
+		return
+	}
+
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		writeRPCResponse(w, request.ID, nil, newRPCError(rpcInvalidRequest, "Invalid request"))
+		return
+	}
+
+	handler, ok := rpcHandlers[request.Method]
+	if !ok {
+		writeRPCResponse(w, request.ID, nil, newRPCError(rpcMethodNotFound, "Method not found: %s", request.Method))
+		return
+	}
+
+	result, err := handler(s, request.Params)
+	writeRPCResponse(w, request.ID, result, err)
+}
+
+func writeRPCResponse(w http.ResponseWriter, id json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = newRPCError(rpcInternalError, "%s", err)
+		}
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Failed to write RPC response: %s\n", err)
+	}
+}
+
+// parseParams decodes the positional params into targets. Params beyond
+// required may be omitted, the targets keep their defaults then.
+func parseParams(params []json.RawMessage, required int, targets ...interface{}) error {
+	if len(params) < required || len(params) > len(targets) {
+		return newRPCError(rpcInvalidParams, "Expected %d to %d params, got %d", required, len(targets), len(params))
+	}
+
+	for i, param := range params {
+		err := json.Unmarshal(param, targets[i])
+		if err != nil {
+			return newRPCError(rpcInvalidParams, "Invalid param %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+func parseHash(s string) ([]byte, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil || len(hash) == 0 {
+		return nil, newRPCError(rpcInvalidParams, "Invalid hash: %s", s)
+	}
+
+	return hash, nil
+}
+
+func rpcChain() (*Blockchain, error) {
+	bc := getLocalChain()
+	if bc == nil {
+		return nil, newRPCError(rpcClientNotReady, "The node doesn't have a blockchain yet")
+	}
+
+	return bc, nil
+}
+
+func rpcGetBlockCount(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	height, _ := bc.GetBestHeight()
+	return height, nil
+}
+
+func rpcGetBestBlockHash(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	_, hash := bc.GetBestHeight()
+	return hex.EncodeToString(hash), nil
+}
+
+func rpcGetBlockHash(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var height int
+	err := parseParams(params, 1, &height)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := bc.GetBlockHashByHeight(height)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "Block height out of range")
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// getblock "hash" (verbosity): 0 returns the serialized block in hex, 1 the
+// block with txids and 2 the block with decoded transactions.
+func rpcGetBlock(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var hashStr string
+	verbosity := 1
+	err := parseParams(params, 1, &hashStr, &verbosity)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := parseHash(hashStr)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return nil, newRPCError(rpcNotFound, "Block not found")
+	}
+
+	if verbosity == 0 {
+		return hex.EncodeToString(block.Serialize()), nil
+	}
+
+	bestHeight, _ := bc.GetBestHeight()
+	return NewBlockJSON(&block, bestHeight, verbosity > 1), nil
+}
+
+// getrawtransaction "txid" (verbose) looks in the mempool and the blockchain.
+func rpcGetRawTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var txIDStr string
+	verbose := false
+	err := parseParams(params, 1, &txIDStr, &verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	txID, err := parseHash(txIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, ok := mempoolTransaction(hex.EncodeToString(txID))
+	if !ok {
+		tx, err = bc.FindTransaction(txID)
+		if err != nil {
+			return nil, newRPCError(rpcNotFound, "No such mempool or blockchain transaction")
+		}
+	}
+
+	if !verbose {
+		return hex.EncodeToString(tx.Serialize()), nil
+	}
+
+	result := NewTxJSON(&tx)
+	result.Hex = hex.EncodeToString(tx.Serialize())
+
+	return result, nil
+}
+
+// gettransaction "txid" finds the transaction in the mempool or through the txindex.
+func rpcGetTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var txIDStr string
+	err := parseParams(params, 1, &txIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	txID, err := parseHash(txIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	if tx, ok := mempoolTransaction(hex.EncodeToString(txID)); ok {
+		result := TxInfoJSON{TxJSON: NewTxJSON(&tx), BlockHeight: -1, Position: -1}
+		result.Hex = hex.EncodeToString(tx.Serialize())
+		return result, nil
+	}
+
+	block, position, err := bc.LocateTransaction(txID)
+	if err != nil {
+		return nil, newRPCError(rpcNotFound, "No such mempool or blockchain transaction")
+	}
+
+	return NewTxInfoJSON(bc, block, position), nil
+}
+
+// sendrawtransaction "hex" adds the transaction to the mempool and relays it.
+func rpcSendRawTransaction(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var txHex string
+	err := parseParams(params, 1, &txHex)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "TX decode failed")
+	}
+
+	tx, err := ParseTransaction(data)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "TX decode failed: %s", err)
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	err = SubmitTransaction(tx, UTXOSet{bc})
+	if err != nil {
+		return nil, newRPCError(rpcVerifyRejected, "%s", err)
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// SubmitTransaction accepts a local transaction into the mempool and relays it.
+func SubmitTransaction(tx *Transaction, utxo UTXOSet) error {
+	if !bytes.Equal(tx.ID, tx.UnsignedHash()) {
+		return errors.New("Transaction ID doesn't match its content")
+	}
+
+	fee, ok := AcceptToMempool(tx, utxo)
+	if !ok {
+		return errors.New("Transaction is rejected by the mempool")
+	}
+
+	if miningLoop != nil {
+		miningLoop.NotifyTransaction(float64(fee) / float64(len(tx.Serialize())))
+	}
+
+	for node, _ := range knownNodes {
+		if node != nodeAddress {
+			sendInv(node, "tx", [][]byte{tx.ID})
+		}
+	}
+
+	return nil
+}
+
+func rpcGetMempoolInfo(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	txs := mempoolTransactions()
+	size := 0
+	for _, tx := range txs {
+		size += len(tx.Serialize())
+	}
+
+	return map[string]interface{}{
+		"size":  len(txs),
+		"bytes": size,
+	}, nil
+}
+
+func rpcGetRawMempool(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	txIDs := []string{}
+	for _, tx := range mempoolTransactions() {
+		txIDs = append(txIDs, hex.EncodeToString(tx.ID))
+	}
+
+	return txIDs, nil
+}
+
+func rpcGetPeerInfo(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	peers := []map[string]interface{}{}
+	for _, node := range StrMap2Slice(knownNodes) {
+		peers = append(peers, map[string]interface{}{
+			"addr":     node,
+			"fullnode": ElementInStrSlice(fullNodes, node),
+		})
+	}
+
+	return peers, nil
+}
+
+// getbalance "address"
+func rpcGetBalance(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var address string
+	err := parseParams(params, 1, &address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidateAddress(address) {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid address")
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.AddressBalance(AddressToPubKeyHash(address)), nil
+}
+
+func rpcGetMiningInfo(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	height, _ := bc.GetBestHeight()
+	result := map[string]interface{}{
+		"blocks":        height,
+		"pooledtx":      mempoolSize(),
+		"hashespersec":  atomic.LoadInt64(&minerHashRate),
+		"targetbits":    targetBits,
+		"miner":         miningLoop != nil,
+		"miningaddress": miningAddress,
+	}
+	if miningLoop != nil {
+		result["paused"] = miningLoop.isPaused()
+	}
+
+	return result, nil
+}
+
+// setmining pause
+func rpcSetMining(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var pause bool
+	err := parseParams(params, 1, &pause)
+	if err != nil {
+		return nil, err
+	}
+
+	if miningLoop == nil {
+		return nil, newRPCError(rpcMiscError, "The node is not a miner")
+	}
+
+	if pause {
+		miningLoop.Pause()
+	} else {
+		miningLoop.Resume()
+	}
+
+	return nil, nil
+}
+
+// createblockchain "address" creates the blockchain of a node which doesn't have one.
+func rpcCreateBlockchain(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var address string
+	err := parseParams(params, 1, &address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidateAddress(address) {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid address")
+	}
+
+	localChainLock.Lock()
+	defer localChainLock.Unlock()
+
+	if localChain != nil || dbExists(fmt.Sprintf(dbFile, s.nodeID)) {
+		return nil, newRPCError(rpcMiscError, "Blockchain already exists")
+	}
+	bc := CreateBlockchain(address, s.nodeID)
+	initIndexes(bc)
+	localChain = bc
+
+	_, hash := localChain.GetBestHeight()
+	return hex.EncodeToString(hash), nil
+}
+
+// reindexutxo rebuilds the UTXO set and returns the number of transactions in it.
+func rpcReindexUTXO(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	utxo := UTXOSet{bc}
+	utxo.Reindex()
+
+	return utxo.CountTransactions(), nil
+}
+
+func rpcStop(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	go func() {
+		// let the response go out first
+		time.Sleep(100 * time.Millisecond)
+		stopNode(s.nodeID)
+	}()
+
+	return "Node stopping", nil
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// walletpassphrase accepts timeouts up to about three years, as bitcoind
+const maxWalletUnlockTimeout = 100000000
+
+// the key of the encrypted wallet of the node while walletpassphrase unlocks it
+var walletKey []byte
+var walletRelock *time.Timer
+var walletKeyLock sync.Mutex
+
+// serializes the handlers which load, change and save the wallet file, so
+// that none of them loses the changes of another
+var walletFileLock sync.Mutex
+
+func init() {
+	rpcHandlers["abortrescan"] = rpcAbortRescan
+	rpcHandlers["createwallet"] = rpcCreateWallet
+	rpcHandlers["encryptwallet"] = rpcEncryptWallet
+	rpcHandlers["getnewaddress"] = rpcGetNewAddress
+	rpcHandlers["getrawchangeaddress"] = rpcGetRawChangeAddress
+	rpcHandlers["getwalletinfo"] = rpcGetWalletInfo
+	rpcHandlers["importaddress"] = rpcImportAddress
+	rpcHandlers["importpubkey"] = rpcImportPubKey
+	rpcHandlers["listaddresses"] = rpcListAddresses
+	rpcHandlers["listtransactions"] = rpcListTransactions
+	rpcHandlers["rescanblockchain"] = rpcRescanBlockchain
+	rpcHandlers["restorewallet"] = rpcRestoreWallet
+	rpcHandlers["sendmany"] = rpcSendMany
+	rpcHandlers["sendtoaddress"] = rpcSendToAddress
+	rpcHandlers["walletlock"] = rpcWalletLock
+	rpcHandlers["walletpassphrase"] = rpcWalletPassphrase
+}
+
+// rpcWallets loads the wallet of the node, unlocked while walletpassphrase unlocks it.
+func rpcWallets(nodeID string) (*Wallets, error) {
+	wallets, err := NewWallets(nodeID)
+	if err != nil {
+		return wallets, err
+	}
+
+	walletKeyLock.Lock()
+	key := walletKey
+	walletKeyLock.Unlock()
+
+	if wallets.IsEncrypted() && key != nil {
+		err = wallets.unlockWithKey(key)
+		if err != nil {
+			return wallets, err
+		}
+	}
+
+	return wallets, nil
+}
+
+// rpcWalletsOrNew loads the wallet of the node as rpcWallets does, or starts
+// an empty one if the node has none.
+func rpcWalletsOrNew(nodeID string) (*Wallets, error) {
+	wallets, err := rpcWallets(nodeID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, newRPCError(rpcWalletError, "%s", err)
+	}
+
+	return wallets, nil
+}
+
+// unlockWallet keeps the key of the wallet until the timeout passes.
+func unlockWallet(key []byte, timeout time.Duration) {
+	walletKeyLock.Lock()
+	defer walletKeyLock.Unlock()
+
+	if walletRelock != nil {
+		walletRelock.Stop()
+	}
+
+	var relock *time.Timer
+	relock = time.AfterFunc(timeout, func() {
+		walletKeyLock.Lock()
+		defer walletKeyLock.Unlock()
+
+		// a later walletpassphrase may have replaced this timer
+		if walletRelock == relock {
+			walletKey = nil
+			walletRelock = nil
+		}
+	})
+	walletKey = key
+	walletRelock = relock
+}
+
+func lockWallet() {
+	walletKeyLock.Lock()
+	defer walletKeyLock.Unlock()
+
+	if walletRelock != nil {
+		walletRelock.Stop()
+	}
+	walletKey = nil
+	walletRelock = nil
+}
+
+// encryptwallet "passphrase" encrypts the wallet of the node, which is locked then.
+func rpcEncryptWallet(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var passphrase string
+	err := parseParams(params, 1, &passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := NewWallets(s.nodeID)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "The node doesn't have a wallet")
+	}
+
+	err = wallets.Encrypt(passphrase)
+	if err == errWalletEncrypted {
+		return nil, newRPCError(rpcWalletWrongEncState, "%s", err)
+	}
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+	wallets.SaveToFile(s.nodeID)
+	lockWallet()
+
+	return "Wallet encrypted, unlock it with walletpassphrase to send coins", nil
+}
+
+// walletpassphrase "passphrase" timeout unlocks the wallet of the node for timeout seconds.
+func rpcWalletPassphrase(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var passphrase string
+	var timeout int
+	err := parseParams(params, 2, &passphrase, &timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		return nil, newRPCError(rpcInvalidParams, "Timeout must be positive")
+	}
+	if timeout > maxWalletUnlockTimeout {
+		timeout = maxWalletUnlockTimeout
+	}
+
+	wallets, err := NewWallets(s.nodeID)
+	if err != nil || !wallets.IsEncrypted() {
+		return nil, newRPCError(rpcWalletWrongEncState, "%s", errWalletNotEncrypted)
+	}
+
+	err = wallets.Unlock(passphrase)
+	if err == errWalletPassphrase {
+		return nil, newRPCError(rpcWalletPassphraseIncorrect, "%s", err)
+	}
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+	unlockWallet(wallets.key, time.Duration(timeout)*time.Second)
+
+	return nil, nil
+}
+
+// walletlock forgets the key of the wallet before the timeout of walletpassphrase.
+func rpcWalletLock(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	wallets, err := NewWallets(s.nodeID)
+	if err != nil || !wallets.IsEncrypted() {
+		return nil, newRPCError(rpcWalletWrongEncState, "%s", errWalletNotEncrypted)
+	}
+
+	lockWallet()
+
+	return nil, nil
+}
+
+// getnewaddress ("type") adds a key-pair to the wallet of the node, type is
+// "ecdsa" or "schnorr".
+func rpcGetNewAddress(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	addressType := "ecdsa"
+	err := parseParams(params, 0, &addressType)
+	if err != nil {
+		return nil, err
+	}
+	if addressType != "ecdsa" && addressType != "schnorr" {
+		return nil, newRPCError(rpcInvalidParams, "Unknown address type %s", addressType)
+	}
+
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := rpcWalletsOrNew(s.nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if wallets.IsLocked() {
+		return nil, newRPCError(rpcWalletUnlockNeeded, "%s", errWalletLocked)
+	}
+	var address string
+	if addressType == "schnorr" {
+		address = wallets.CreateSchnorrWallet()
+	} else {
+		address = wallets.CreateWallet()
+	}
+	wallets.SaveToFile(s.nodeID)
+
+	return address, nil
+}
+
+// getrawchangeaddress adds a key-pair for change to the wallet of the node.
+func rpcGetRawChangeAddress(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := rpcWalletsOrNew(s.nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if wallets.IsLocked() {
+		return nil, newRPCError(rpcWalletUnlockNeeded, "%s", errWalletLocked)
+	}
+	address := wallets.CreateChangeWallet()
+	wallets.SaveToFile(s.nodeID)
+
+	return address, nil
+}
+
+// createwallet (words "passphrase" account) starts an HD wallet from a new
+// mnemonic and returns it with the first address.
+func rpcCreateWallet(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	words := 12
+	passphrase := ""
+	account := uint32(0)
+	err := parseParams(params, 0, &words, &passphrase, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	mnemonic, err := NewMnemonic(words)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := NewHDWallets(s.nodeID, mnemonic, passphrase, account)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+	address := wallets.CreateWallet()
+	wallets.SaveToFile(s.nodeID)
+
+	return CreateWalletJSON{mnemonic, address}, nil
+}
+
+// restorewallet "mnemonic" ("passphrase" account gap) derives the keys of a
+// mnemonic which the chain has used.
+func rpcRestoreWallet(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var mnemonic string
+	passphrase := ""
+	account := uint32(0)
+	gap := hdGapLimit
+	err := parseParams(params, 1, &mnemonic, &passphrase, &account, &gap)
+	if err != nil {
+		return nil, err
+	}
+	if gap <= 0 {
+		return nil, newRPCError(rpcInvalidParams, "Gap must be positive")
+	}
+
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := NewHDWallets(s.nodeID, mnemonic, passphrase, account)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+
+	used := usedPubKeyHashes(getLocalChain())
+	result := RestoreWalletJSON{Used: wallets.Recover(func(pubKeyHash []byte) bool {
+		return used[string(pubKeyHash)]
+	}, gap)}
+	if len(wallets.Wallets) == 0 {
+		wallets.CreateWallet()
+	}
+	wallets.SaveToFile(s.nodeID)
+
+	result.Addresses = wallets.GetAddresses()
+
+	return result, nil
+}
+
+func rpcListAddresses(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	wallets, err := NewWallets(s.nodeID)
+	if err != nil {
+		return []string{}, nil
+	}
+
+	addresses := wallets.GetAddresses()
+	if addresses == nil {
+		addresses = []string{}
+	}
+
+	return addresses, nil
+}
+
+// sendtoaddress "from" "to" amount (mine "coinselect" feerate) signs with the
+// wallet of the node. The transaction is relayed, or mined right away when
+// mine is set. coinselect names the coin selection strategy, feerate is the
+// fee in coins per 1000 bytes.
+func rpcSendToAddress(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var from, to string
+	var amount int
+	mine := false
+	coinSelect := defaultCoinSelector
+	feeRate := 0.0
+	err := parseParams(params, 3, &from, &to, &amount, &mine, &coinSelect, &feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidateAddress(from) || !ValidateAddress(to) {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid address")
+	}
+	if amount <= 0 {
+		return nil, newRPCError(rpcInvalidParams, "Amount must be positive")
+	}
+	if _, ok := coinSelectors[coinSelect]; !ok {
+		return nil, newRPCError(rpcInvalidParams, "Unknown coin selection %s", coinSelect)
+	}
+	if feeRate < 0 {
+		return nil, newRPCError(rpcInvalidParams, "Fee rate must not be negative")
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	walletFileLock.Lock()
+	wallets, err := rpcWallets(s.nodeID)
+	walletFileLock.Unlock()
+	if err != nil || wallets.Wallets[from] == nil {
+		return nil, newRPCError(rpcInvalidAddress, "The wallet doesn't have the key of %s", from)
+	}
+	if wallets.IsLocked() {
+		return nil, newRPCError(rpcWalletUnlockNeeded, "%s", errWalletLocked)
+	}
+	wallet := wallets.GetWallet(from)
+
+	utxo := UTXOSet{bc}
+	tx, _, err := NewPaymentTransaction(&wallet, []TXOutput{*NewTXOutput(amount, to)}, &utxo, coinSelect, feeRate)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+
+	if mine {
+		_, err = bc.MineTransactions([]*Transaction{tx}, from)
+	} else {
+		err = SubmitTransaction(tx, utxo)
+	}
+	if err != nil {
+		return nil, newRPCError(rpcVerifyRejected, "%s", err)
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// sendmany "from" payments (mine "coinselect" feerate dryrun) pays all the
+// payments, an array of {"address", "amount"} or an object of address to
+// amount, in one transaction. A dry run returns the signed transaction
+// without relaying it.
+func rpcSendMany(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var from string
+	var paymentData json.RawMessage
+	mine := false
+	coinSelect := defaultCoinSelector
+	feeRate := 0.0
+	dryRun := false
+	err := parseParams(params, 2, &from, &paymentData, &mine, &coinSelect, &feeRate, &dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidateAddress(from) {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid address")
+	}
+	payments, err := ParsePayments(paymentData)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "%s", err)
+	}
+	if _, ok := coinSelectors[coinSelect]; !ok {
+		return nil, newRPCError(rpcInvalidParams, "Unknown coin selection %s", coinSelect)
+	}
+	if feeRate < 0 {
+		return nil, newRPCError(rpcInvalidParams, "Fee rate must not be negative")
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	walletFileLock.Lock()
+	wallets, err := rpcWallets(s.nodeID)
+	walletFileLock.Unlock()
+	if err != nil || wallets.Wallets[from] == nil {
+		return nil, newRPCError(rpcInvalidAddress, "The wallet doesn't have the key of %s", from)
+	}
+	if wallets.IsLocked() {
+		return nil, newRPCError(rpcWalletUnlockNeeded, "%s", errWalletLocked)
+	}
+	wallet := wallets.GetWallet(from)
+
+	utxo := UTXOSet{bc}
+	tx, selection, err := NewPaymentTransaction(&wallet, PaymentOutputs(payments), &utxo, coinSelect, feeRate)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "%s", err)
+	}
+
+	result := NewSendManyJSON(tx, selection, len(payments))
+	if dryRun {
+		result.Hex = hex.EncodeToString(tx.Serialize())
+		return result, nil
+	}
+
+	if mine {
+		_, err = bc.MineTransactions([]*Transaction{tx}, from)
+	} else {
+		err = SubmitTransaction(tx, utxo)
+	}
+	if err != nil {
+		return nil, newRPCError(rpcVerifyRejected, "%s", err)
+	}
+
+	return result, nil
+}
+
+// importaddress "address" (rescan) watches address, whose transactions are
+// tracked from the next block on, or from the genesis block if rescan is true.
+func rpcImportAddress(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var address string
+	var rescan bool
+	err := parseParams(params, 1, &address, &rescan)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = importWatchOnly(s.nodeID, func(wallets *Wallets) (string, error) {
+		return address, wallets.ImportAddress(address)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rescan {
+		err := rpcRescan()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return address, nil
+}
+
+// importpubkey "pubkey" (rescan) watches the address of the hex-encoded
+// public key as importaddress does.
+func rpcImportPubKey(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	var pubKeyHex string
+	var rescan bool
+	err := parseParams(params, 1, &pubKeyHex, &rescan)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidAddress, "Invalid public key")
+	}
+
+	address, err := importWatchOnly(s.nodeID, func(wallets *Wallets) (string, error) {
+		return wallets.ImportPubKey(pubKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rescan {
+		err := rpcRescan()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return address, nil
+}
+
+// importWatchOnly adds a watch-only address to the wallet of the node with
+// add and returns it. The rescan which may follow runs without the lock.
+func importWatchOnly(nodeID string, add func(*Wallets) (string, error)) (string, error) {
+	walletFileLock.Lock()
+	defer walletFileLock.Unlock()
+
+	wallets, err := rpcWalletsOrNew(nodeID)
+	if err != nil {
+		return "", err
+	}
+
+	address, err := add(wallets)
+	if err != nil {
+		return "", newRPCError(rpcInvalidAddress, "%s", err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	return address, nil
+}
+
+// rpcRescan rescans the whole chain after an import.
+func rpcRescan() error {
+	bc, err := rpcChain()
+	if err != nil {
+		return err
+	}
+
+	_, err = bc.RescanWallet(0, -1, printRescanProgress())
+	if err != nil {
+		return newRPCError(rpcWalletError, "%s", err)
+	}
+
+	return nil
+}
+
+// listtransactions (count skip) lists count transactions of the wallet before
+// the last skip ones, the oldest first.
+func rpcListTransactions(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	count := 10
+	skip := 0
+	err := parseParams(params, 0, &count, &skip)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || skip < 0 {
+		return nil, newRPCError(rpcInvalidParams, "Count and skip must not be negative")
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+	bestHeight, _ := bc.GetBestHeight()
+
+	return listWalletTransactions(bc.WalletTransactions(), count, skip, bestHeight), nil
+}
+
+func rpcGetWalletInfo(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	wallets, err := rpcWallets(s.nodeID)
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, "The node doesn't have a wallet")
+	}
+
+	var wtxs []WalletTransaction
+	if bc := getLocalChain(); bc != nil {
+		wtxs = bc.WalletTransactions()
+	}
+
+	return NewWalletInfoJSON(wallets, wtxs), nil
+}
+
+// rescanblockchain (start_height stop_height) rebuilds the wallet transactions
+// of the blocks from start_height, the genesis block by default, to
+// stop_height, the tip by default. abortrescan stops it, the result tells
+// where.
+func rpcRescanBlockchain(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	from := 0
+	to := -1
+	err := parseParams(params, 0, &from, &to)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := rpcChain()
+	if err != nil {
+		return nil, err
+	}
+
+	scanned, err := bc.RescanWallet(from, to, printRescanProgress())
+	if err == errRescanAborted {
+		return RescanJSON{from, scanned, true}, nil
+	}
+	if err != nil {
+		return nil, newRPCError(rpcWalletError, "%s", err)
+	}
+
+	return RescanJSON{from, scanned, false}, nil
+}
+
+// abortrescan stops the running rescan, it returns whether there is one.
+func rpcAbortRescan(s *RPCServer, params []json.RawMessage) (interface{}, error) {
+	return AbortRescan(), nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// Schnorr public keys are the x coordinate of a point with even y, BIP340
+const schnorrPubKeyLen = 32
+
+// the width of the NAF digits of the multi-scalar multiplication of a batch
+const batchWindow = 5
+
+// SchnorrBatch collects the Schnorr signatures of a block to check them at once.
+// With random weights a_i the signatures are valid if
+// (sum a_i*s_i)*G = sum a_i*R_i + sum a_i*e_i*P_i, which shares the doublings of
+// all the scalar multiplications and adds up the weights of repeated keys.
+type SchnorrBatch struct {
+	entries []schnorrBatchEntry
+	seen    map[string]bool
+}
+
+type schnorrBatchEntry struct {
+	pubKey    []byte
+	hash      []byte
+	signature []byte
+}
+
+// Add queues a signature of hash by the x-only pubKey. The same signature of
+// the same hash, like in every input of a transaction with one key, is only
+// checked once.
+func (b *SchnorrBatch) Add(pubKey, hash, signature []byte) {
+	key := string(pubKey) + string(hash) + string(signature)
+	if b.seen == nil {
+		b.seen = make(map[string]bool)
+	}
+	if b.seen[key] {
+		return
+	}
+	b.seen[key] = true
+
+	b.entries = append(b.entries, schnorrBatchEntry{pubKey, hash, signature})
+}
+
+func (b *SchnorrBatch) Len() int {
+	return len(b.entries)
+}
+
+// Verify reports whether all the signatures of the batch are valid.
+func (b *SchnorrBatch) Verify() bool {
+	if len(b.entries) == 0 {
+		return true
+	}
+	if len(b.entries) == 1 {
+		entry := b.entries[0]
+		pubKey, err := schnorr.ParsePubKey(entry.pubKey)
+		if err != nil {
+			return false
+		}
+		signature, err := schnorr.ParseSignature(entry.signature)
+		if err != nil {
+			return false
+		}
+
+		return signature.Verify(entry.hash, pubKey)
+	}
+
+	var sSum btcec.ModNScalar
+	var points []btcec.JacobianPoint
+	var scalars []btcec.ModNScalar
+	keyIndex := make(map[string]int)
+
+	for i, entry := range b.entries {
+		if len(entry.signature) != 64 || len(entry.hash) != 32 {
+			return false
+		}
+
+		pubKey, err := schnorr.ParsePubKey(entry.pubKey)
+		if err != nil {
+			return false
+		}
+
+		// R = lift_x(r), fail if r >= p or not on the curve
+		var rx, ry btcec.FieldVal
+		if rx.SetByteSlice(entry.signature[:32]) {
+			return false
+		}
+		if !btcec.DecompressY(&rx, false, &ry) {
+			return false
+		}
+		ry.Normalize()
+
+		var s btcec.ModNScalar
+		if s.SetByteSlice(entry.signature[32:]) {
+			return false
+		}
+
+		// e = int(tagged_hash("BIP0340/challenge", r || P || m)) mod n
+		var e btcec.ModNScalar
+		e.SetByteSlice(taggedHash("BIP0340/challenge", entry.signature[:32], entry.pubKey, entry.hash))
+
+		// a_1 = 1, the others are random so that invalid signatures can't cancel out
+		var a btcec.ModNScalar
+		if i == 0 {
+			a.SetInt(1)
+		} else if !randomScalar(&a) {
+			return false
+		}
+
+		sSum.Add(new(btcec.ModNScalar).Mul2(&a, &s))
+
+		points = append(points, btcec.MakeJacobianPoint(&rx, &ry, new(btcec.FieldVal).SetInt(1)))
+		scalars = append(scalars, a)
+
+		e.Mul(&a)
+		index, ok := keyIndex[string(entry.pubKey)]
+		if ok {
+			scalars[index].Add(&e)
+			continue
+		}
+		var p btcec.JacobianPoint
+		pubKey.AsJacobian(&p)
+		keyIndex[string(entry.pubKey)] = len(points)
+		points = append(points, p)
+		scalars = append(scalars, e)
+	}
+
+	var left, right btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&sSum, &left)
+	multiScalarMult(scalars, points, &right)
+
+	left.ToAffine()
+	right.ToAffine()
+
+	return left.X.Equals(&right.X) && left.Y.Equals(&right.Y)
+}
+
+// multiScalarMult sets result to sum scalars[i]*points[i] by Straus' method:
+// the points share the doublings and add a precomputed odd multiple for
+// every non-zero digit of the width-w NAF of their scalar.
+func multiScalarMult(scalars []btcec.ModNScalar, points []btcec.JacobianPoint, result *btcec.JacobianPoint) {
+	// tables[i][j] is (2j+1)*points[i], negated[i][j] is its negation
+	tables := make([][1 << (batchWindow - 2)]btcec.JacobianPoint, len(points))
+	negated := make([][1 << (batchWindow - 2)]btcec.JacobianPoint, len(points))
+	digits := make([][257]int8, len(points))
+	var multiples []*btcec.JacobianPoint
+
+	for i := range points {
+		var double btcec.JacobianPoint
+		btcec.DoubleNonConst(&points[i], &double)
+
+		tables[i][0] = points[i]
+		for j := 1; j < len(tables[i]); j++ {
+			btcec.AddNonConst(&tables[i][j-1], &double, &tables[i][j])
+			multiples = append(multiples, &tables[i][j])
+		}
+
+		digits[i] = wnaf(&scalars[i])
+	}
+
+	// affine multiples make the additions below cheaper
+	batchToAffine(multiples)
+
+	for i := range tables {
+		for j := range tables[i] {
+			negated[i][j] = tables[i][j]
+			negated[i][j].Y.Negate(1).Normalize()
+		}
+	}
+
+	var acc btcec.JacobianPoint
+	for bit := len(digits[0]) - 1; bit >= 0; bit-- {
+		btcec.DoubleNonConst(&acc, &acc)
+
+		for i := range points {
+			d := digits[i][bit]
+			if d > 0 {
+				btcec.AddNonConst(&acc, &tables[i][d/2], &acc)
+			} else if d < 0 {
+				btcec.AddNonConst(&acc, &negated[i][-d/2], &acc)
+			}
+		}
+	}
+
+	result.Set(&acc)
+}
+
+// wnaf returns the width-w non-adjacent form of s, least significant digit
+// first. The digits are zero or odd within ±2^(w-1), no w adjacent ones are non-zero.
+func wnaf(s *btcec.ModNScalar) [257]int8 {
+	var digits [257]int8
+	b := s.Bytes()
+
+	// bits returns count bits of s from bit on
+	bits := func(bit, count int) int {
+		value := 0
+		for j := count - 1; j >= 0; j-- {
+			value <<= 1
+			if bit+j < 256 && b[31-(bit+j)/8]>>uint((bit+j)%8)&1 == 1 {
+				value |= 1
+			}
+		}
+		return value
+	}
+
+	carry := 0
+	for bit := 0; bit < len(digits); {
+		if bits(bit, 1) == carry {
+			bit++
+			continue
+		}
+
+		word := bits(bit, batchWindow) + carry
+		carry = word >> (batchWindow - 1) & 1
+		word -= carry << batchWindow
+		digits[bit] = int8(word)
+		bit += batchWindow
+	}
+
+	return digits
+}
+
+// batchToAffine sets Z to 1 in all points, none at infinity, with one
+// inversion for all of them by Montgomery's trick.
+func batchToAffine(points []*btcec.JacobianPoint) {
+	if len(points) == 0 {
+		return
+	}
+
+	// products[i] is the product of the Z of points[0..i]
+	products := make([]btcec.FieldVal, len(points))
+	products[0].Set(&points[0].Z)
+	for i := 1; i < len(points); i++ {
+		products[i].Mul2(&products[i-1], &points[i].Z)
+	}
+
+	var inverse btcec.FieldVal
+	inverse.Set(&products[len(points)-1]).Inverse()
+
+	for i := len(points) - 1; i >= 0; i-- {
+		// zInv is 1/Z of points[i], inverse becomes 1/(Z_0 * ... * Z_{i-1})
+		var zInv btcec.FieldVal
+		if i > 0 {
+			zInv.Mul2(&inverse, &products[i-1])
+			inverse.Mul(&points[i].Z)
+		} else {
+			zInv.Set(&inverse)
+		}
+
+		var zInv2 btcec.FieldVal
+		zInv2.SquareVal(&zInv)
+		points[i].X.Mul(&zInv2).Normalize()
+		points[i].Y.Mul(zInv2.Mul(&zInv)).Normalize()
+		points[i].Z.SetInt(1)
+	}
+}
+
+// randomScalar sets s to a random non-zero 128 bit scalar, which makes a
+// forged batch pass with a chance of 2^-128 but halves the work of the R_i.
+func randomScalar(s *btcec.ModNScalar) bool {
+	var buf [32]byte
+	for {
+		_, err := rand.Read(buf[16:])
+		if err != nil {
+			return false
+		}
+		s.SetBytes(&buf)
+		if !s.IsZero() {
+			return true
+		}
+	}
+}
+
+// taggedHash is the BIP340 hash SHA256(SHA256(tag) || SHA256(tag) || data).
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// the order of secp256k1
+const curveOrderHex = "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141"
+
+func scalarFromHex(t *testing.T, s string) btcec.ModNScalar {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scalar btcec.ModNScalar
+	if scalar.SetByteSlice(b) {
+		t.Fatalf("%s overflows", s)
+	}
+
+	return scalar
+}
+
+func randomPoint(t *testing.T) btcec.JacobianPoint {
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p btcec.JacobianPoint
+	key.PubKey().AsJacobian(&p)
+
+	return p
+}
+
+func TestWNAF(t *testing.T) {
+	scalars := []string{
+		"00",
+		"01",
+		"1F",
+		"20",
+		// n-1 and n-2 end in a run of ones which carries into bit 256
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364140",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD036413F",
+		"F800000000000000000000000000000000000000000000000000000000000000",
+		"8000000000000000000000000000000000000000000000000000000000000000",
+		"5555555555555555555555555555555555555555555555555555555555555555",
+	}
+
+	carried := false
+	for _, s := range scalars {
+		scalar := scalarFromHex(t, s)
+		digits := wnaf(&scalar)
+
+		value := new(big.Int)
+		last := -batchWindow
+		for bit := len(digits) - 1; bit >= 0; bit-- {
+			d := int64(digits[bit])
+			value.Lsh(value, 1).Add(value, big.NewInt(d))
+			if d == 0 {
+				continue
+			}
+
+			if d%2 == 0 || d >= 1<<(batchWindow-1) || d <= -1<<(batchWindow-1) {
+				t.Fatalf("%s: digit %d at bit %d", s, d, bit)
+			}
+			if last-bit < batchWindow && last != -batchWindow {
+				t.Fatalf("%s: digits at bits %d and %d are adjacent", s, last, bit)
+			}
+			last = bit
+		}
+
+		want, _ := new(big.Int).SetString(s, 16)
+		if value.Cmp(want) != 0 {
+			t.Fatalf("%s: digits sum to %x", s, value)
+		}
+		carried = carried || digits[256] != 0
+	}
+
+	if !carried {
+		t.Fatal("no scalar carried into bit 256")
+	}
+}
+
+func TestMultiScalarMult(t *testing.T) {
+	orderMinusOne := scalarFromHex(t, "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364140")
+
+	var points []btcec.JacobianPoint
+	var scalars []btcec.ModNScalar
+	for i := 0; i < 12; i++ {
+		var s btcec.ModNScalar
+		switch i {
+		case 0:
+			s.SetInt(0)
+		case 1:
+			s.SetInt(1)
+		case 2:
+			s = orderMinusOne
+		default:
+			randomScalar(&s)
+			if i%2 == 0 {
+				// full 256 bit scalars as well as the 128 bit weights
+				key, _ := btcec.NewPrivateKey()
+				s = key.Key
+			}
+		}
+
+		p := randomPoint(t)
+		if i == 5 {
+			// the same point twice
+			p = points[4]
+		}
+		points = append(points, p)
+		scalars = append(scalars, s)
+	}
+
+	var want btcec.JacobianPoint
+	for i := range points {
+		var term btcec.JacobianPoint
+		btcec.ScalarMultNonConst(&scalars[i], &points[i], &term)
+		btcec.AddNonConst(&want, &term, &want)
+	}
+
+	var got btcec.JacobianPoint
+	multiScalarMult(scalars, points, &got)
+
+	want.ToAffine()
+	got.ToAffine()
+	if !want.X.Equals(&got.X) || !want.Y.Equals(&got.Y) {
+		t.Fatal("multi-scalar multiplication differs from the sum of the products")
+	}
+}
+
+func TestBatchToAffine(t *testing.T) {
+	var points []*btcec.JacobianPoint
+	var want []btcec.JacobianPoint
+	for i := 0; i < 5; i++ {
+		// a sum has Z != 1
+		a, b := randomPoint(t), randomPoint(t)
+		var sum btcec.JacobianPoint
+		btcec.AddNonConst(&a, &b, &sum)
+
+		points = append(points, &sum)
+		affine := sum
+		affine.ToAffine()
+		want = append(want, affine)
+	}
+
+	batchToAffine(points)
+	for i, p := range points {
+		if !p.X.Equals(&want[i].X) || !p.Y.Equals(&want[i].Y) || !p.Z.IsOne() {
+			t.Fatalf("point %d", i)
+		}
+	}
+}
+
+type schnorrTestSig struct {
+	pubKey    []byte
+	hash      []byte
+	signature []byte
+}
+
+func newSchnorrTestSig(t *testing.T, key *btcec.PrivateKey, hash []byte) schnorrTestSig {
+	signature, err := schnorr.Sign(key, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return schnorrTestSig{schnorr.SerializePubKey(key.PubKey()), hash, signature.Serialize()}
+}
+
+func verifyBatch(sigs []schnorrTestSig) bool {
+	var batch SchnorrBatch
+	for _, sig := range sigs {
+		batch.Add(sig.pubKey, sig.hash, sig.signature)
+	}
+
+	return batch.Verify()
+}
+
+func TestSchnorrBatch(t *testing.T) {
+	var sigs []schnorrTestSig
+	var keys []*btcec.PrivateKey
+	for i := 0; i < 16; i++ {
+		key, _ := btcec.NewPrivateKey()
+		keys = append(keys, key)
+		sigs = append(sigs, newSchnorrTestSig(t, key, taggedHash("test", []byte{byte(i)})))
+	}
+	// repeated keys signing other messages add up their weights
+	for i := 0; i < 4; i++ {
+		sigs = append(sigs, newSchnorrTestSig(t, keys[i%2], taggedHash("again", []byte{byte(i)})))
+	}
+
+	if !verifyBatch(sigs) {
+		t.Fatal("valid batch rejected")
+	}
+
+	var batch SchnorrBatch
+	batch.Add(sigs[0].pubKey, sigs[0].hash, sigs[0].signature)
+	batch.Add(sigs[0].pubKey, sigs[0].hash, sigs[0].signature)
+	if batch.Len() != 1 {
+		t.Fatal("a repeated signature is queued twice")
+	}
+
+	corruptions := map[string]func(sig *schnorrTestSig){
+		"message bit": func(sig *schnorrTestSig) {
+			sig.hash[0] ^= 1
+		},
+		"r bit": func(sig *schnorrTestSig) {
+			sig.signature[5] ^= 1
+		},
+		"s bit": func(sig *schnorrTestSig) {
+			sig.signature[63] ^= 1
+		},
+		"s = n": func(sig *schnorrTestSig) {
+			order, _ := hex.DecodeString(curveOrderHex)
+			copy(sig.signature[32:], order)
+		},
+		"other key": func(sig *schnorrTestSig) {
+			sig.pubKey = sigs[2].pubKey
+		},
+	}
+	for name, corrupt := range corruptions {
+		// the first signature has weight 1, a repeated key shares its scalar
+		for _, i := range []int{0, 7, 17} {
+			bad := make([]schnorrTestSig, len(sigs))
+			copy(bad, sigs)
+			bad[i] = schnorrTestSig{
+				append([]byte{}, sigs[i].pubKey...),
+				append([]byte{}, sigs[i].hash...),
+				append([]byte{}, sigs[i].signature...),
+			}
+			corrupt(&bad[i])
+
+			if verifyBatch(bad) {
+				t.Fatalf("batch with %s of signature %d accepted", name, i)
+			}
+		}
+	}
+}
+
+// BIP340 test vectors
+var bip340Vectors = []struct {
+	pubKey    string
+	message   string
+	signature string
+	valid     bool
+}{
+	{"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9", "0000000000000000000000000000000000000000000000000000000000000000", "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0", true},
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A", true},
+	{"DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8", "7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C", "5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7", true},
+	{"25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3", true},
+	{"D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703", "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+	// public key not on the curve
+	{"EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// R has an odd y
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+	// negated message
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD", false},
+	// negated s
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6", false},
+	// sG - eP is infinite
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051", false},
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197", false},
+	// r is not the x of a point
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// r = p
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// s = n
+	{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", false},
+	// public key x = p
+	{"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+}
+
+func TestBIP340Vectors(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	other := newSchnorrTestSig(t, key, taggedHash("other"))
+
+	for i, vector := range bip340Vectors {
+		pubKey, _ := hex.DecodeString(vector.pubKey)
+		message, _ := hex.DecodeString(vector.message)
+		signature, _ := hex.DecodeString(vector.signature)
+
+		tx := Transaction{nil, []TXInput{{[]byte{1}, 0, signature, pubKey}}, nil}
+		if tx.verifyInput(0, message, nil) != vector.valid {
+			t.Fatalf("vector %d: single verification is not %t", i, vector.valid)
+		}
+
+		// a batch of one falls back to single verification, a second
+		// signature makes it run the multi-scalar multiplication
+		var batch SchnorrBatch
+		added := tx.verifyInput(0, message, &batch)
+		batch.Add(other.pubKey, other.hash, other.signature)
+		if (added && batch.Verify()) != vector.valid {
+			t.Fatalf("vector %d: batch verification is not %t", i, vector.valid)
+		}
+	}
+}
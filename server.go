@@ -9,6 +9,10 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 const protocol = "tcp"
@@ -30,6 +34,10 @@ var blocksInTransit = make(map[string]int)
 // store pending transactions
 var mempool = make(map[string]Transaction)
 
+// the single open blockchain of this node. It is nil until the node has a genesis block.
+var localChain *Blockchain
+var localChainLock sync.Mutex
+
 type addr struct {
 	AddrList []string
 }
@@ -56,6 +64,11 @@ type inv struct {
 	Items    [][]byte
 }
 
+type mining struct {
+	AddrFrom string
+	Pause    bool
+}
+
 type tx struct {
 	AddFrom     string
 	Transaction []byte
@@ -140,11 +153,14 @@ func sendData(addr string, data []byte) {
 		return
 	}
 	defer conn.Close()
+	metrics.ConnectionOpened("outbound")
+	defer metrics.ConnectionClosed("outbound")
 
 	_, err = io.Copy(conn, bytes.NewReader(data))
 	if err != nil {
 		log.Panic(err)
 	}
+	metrics.MessageSent(bytesToCommand(data[:commandLength]), len(data))
 }
 
 func sendInv(address, kind string, items [][]byte) {
@@ -169,6 +185,13 @@ func sendGetData(address, kind string, id []byte) {
 	sendData(address, request)
 }
 
+func sendMining(addr string, pause bool) {
+	payload := gobEncode(mining{nodeAddress, pause})
+	request := append(commandToBytes("mining"), payload...)
+
+	sendData(addr, request)
+}
+
 func sendTx(addr string, tnx *Transaction) {
 	data := tx{nodeAddress, tnx.Serialize()}
 	payload := gobEncode(data)
@@ -235,14 +258,14 @@ func handleBlock(request []byte, bc *Blockchain) {
 				fmt.Printf("Accept that genesis block %x and create a blockchain", block.Hash)
 				utxo := UTXOSet{bc}
 				utxo.Reindex()
-
+				initIndexes(bc)
+				setLocalChain(bc)
+				publishBlockConnected(block)
 			}
-		} else if dbExists(fmt.Sprintf(dbFile, nodeID)) {
-			utxo := UTXOSet{bc}
-			if utxo.VerifyBlock(block, true) {
+		} else if bc != nil {
+			if bc.ConnectBlock(block) {
 				fmt.Println("Receive a block.")
-				bc.AddBlock(block)
-				utxo.Update(block)
+				RemoveFromMempool(block.Transactions)
 				fmt.Printf("Added block %x\n", block.Hash)
 
 			}
@@ -298,7 +321,7 @@ func handleInv(request []byte, bc *Blockchain) {
 	if payload.Type == "tx" {
 		// Ask for one id in the payload
 		for _, txID := range payload.Items {
-			if mempool[hex.EncodeToString(txID)].ID == nil {
+			if _, ok := mempoolTransaction(hex.EncodeToString(txID)); !ok {
 				sendGetData(payload.AddrFrom, "tx", txID)
 				break
 			}
@@ -356,12 +379,40 @@ func handleGetData(request []byte, bc *Blockchain) {
 
 	if payload.Type == "tx" {
 		txID := hex.EncodeToString(payload.ID)
-		tx := mempool[txID]
+		tx, ok := mempoolTransaction(txID)
+		if !ok {
+			return
+		}
 
 		sendTx(payload.AddrFrom, &tx)
 	}
 }
 
+func handleMining(request []byte) {
+	var buff bytes.Buffer
+	var payload mining
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if miningLoop == nil {
+		fmt.Println("I am not a miner.")
+		return
+	}
+
+	if payload.Pause {
+		miningLoop.Pause()
+		fmt.Println("Mining is paused.")
+	} else {
+		miningLoop.Resume()
+		fmt.Println("Mining is resumed.")
+	}
+}
+
 //
 func handleTx(reuqest []byte, bc *Blockchain) {
 	var buff bytes.Buffer
@@ -378,11 +429,7 @@ func handleTx(reuqest []byte, bc *Blockchain) {
 
 	txData := payload.Transaction
 	newTx := DeserializeTransaction(txData)
-	// no coinbase transacton in the mempool
-	if utxo.VerifyTransaction(&newTx) && !newTx.IsCoinbase() {
-		// use map can sure that transactions in the block are different
-		mempool[hex.EncodeToString(newTx.ID)] = newTx
-	}
+	fee, accepted := AcceptToMempool(&newTx, utxo)
 
 	/*
 		Checks whether the current node is the central one.
@@ -396,68 +443,8 @@ func handleTx(reuqest []byte, bc *Blockchain) {
 				sendInv(node, "tx", [][]byte{newTx.ID})
 			}
 		}
-	} else { // Only for miner nodes
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*Transaction
-
-			for id := range mempool {
-				tx := mempool[id]
-				if utxo.VerifyTransaction(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
-
-			var tmpTxs []*Transaction
-			count := make(map[string]map[int]int)
-			// prevent two pending transactions use the same utxo
-
-			for _, tx := range txs {
-				// pay attention to coinbase
-				ok := true
-				for _, vin := range tx.Vin {
-					count[hex.EncodeToString(vin.Txid)][vin.Vout]++
-					if count[hex.EncodeToString(vin.Txid)][vin.Vout] != 1 {
-						ok = false
-						delete(mempool, hex.EncodeToString(tx.ID))
-						break
-					}
-				}
-				if ok {
-					tmpTxs = append(tmpTxs, tx)
-				}
-			}
-
-			txs = tmpTxs
-
-			if len(txs) == 0 {
-				fmt.Println("All transactions are invalid! Waiting for new ones...")
-				return
-			}
-
-			cbTx := NewCoinbaseTX(miningAddress, "")
-			txs = append(txs, cbTx)
-
-			newBlock := bc.MineBlock(txs, &utxo)
-			utxo.Update(newBlock)
-
-			fmt.Println("New block is mined!")
-
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
-
-			for node, _ := range knownNodes {
-				if node != nodeAddress {
-					sendInv(node, "block", [][]byte{newBlock.Hash})
-				}
-			}
-
-			if len(mempool) > 0 {
-				goto MineTransactions
-			}
-		}
+	} else if accepted && miningLoop != nil { // Only for miner nodes
+		miningLoop.NotifyTransaction(float64(fee) / float64(len(txData)))
 	}
 }
 
@@ -501,6 +488,8 @@ func handleVersion(request []byte, bc *Blockchain) {
 }
 
 func handleConnection(conn net.Conn, bc *Blockchain) {
+	metrics.ConnectionOpened("inbound")
+	defer metrics.ConnectionClosed("inbound")
 
 	request, err := ioutil.ReadAll(conn)
 	if err != nil {
@@ -509,6 +498,7 @@ func handleConnection(conn net.Conn, bc *Blockchain) {
 
 	command := bytesToCommand(request[:commandLength])
 	fmt.Printf("Received %s command\n", command)
+	metrics.MessageReceived(command, len(request))
 
 	switch command {
 	case "addr":
@@ -520,12 +510,33 @@ func handleConnection(conn net.Conn, bc *Blockchain) {
 	case "inv":
 		handleInv(request, bc)
 
+	case "mining":
+		handleMining(request)
+
+	case "submitblock":
+		handleSubmitBlock(conn, request, bc)
+
 	case "getblocks":
 		handleGetBlocks(request, bc)
 
 	case "getdata":
 		handleGetData(request, bc)
 
+	case "getheaders":
+		handleGetHeaders(conn, request, bc)
+
+	case "getmerkleblk":
+		handleGetMerkleBlock(conn, request, bc)
+
+	case "getcfilters":
+		handleGetCFilters(conn, request, bc)
+
+	case "getcfheaders":
+		handleGetCFHeaders(conn, request, bc)
+
+	case "gettemplate":
+		handleGetTemplate(conn, request, bc)
+
 	case "tx":
 		handleTx(request, bc)
 
@@ -536,9 +547,6 @@ func handleConnection(conn net.Conn, bc *Blockchain) {
 		fmt.Println("Unknown command!")
 	}
 
-	if bc != nil {
-		bc.db.Close()
-	}
 	conn.Close()
 
 }
@@ -553,6 +561,8 @@ func StartServer(nodeID, minerAddress string) {
 
 	defer ln.Close()
 
+	go handleShutdown(nodeID, ln)
+
 	InitNewWork()
 
 	dbFile := fmt.Sprintf(dbFile, nodeID)
@@ -564,14 +574,22 @@ func StartServer(nodeID, minerAddress string) {
 		fmt.Printf("%s sends version to %s\n", nodeAddress, fullNodes[0])
 	} else {
 		bc = NewBlockchain(nodeID)
+		initIndexes(bc)
 		height, _ := bc.GetBestHeight()
-		bc.db.Close()
+		restored := LoadMempool(nodeID, bc)
 		fmt.Printf("I already have a blockchain with height %d.\n", height)
+		fmt.Printf("Restored %d pending transactions.\n", restored)
 		if ElementInStrSlice(fullNodes, nodeAddress) == false {
 			sendVersion(fullNodes[0], bc)
 			fmt.Printf("%s sends version to %s\n", nodeAddress, fullNodes[0])
 		}
 	}
+	setLocalChain(bc)
+
+	if len(miningAddress) > 0 && !ElementInStrSlice(fullNodes, nodeAddress) {
+		miningLoop = NewMiningLoop(miningAddress, miningInterval)
+		go miningLoop.Run()
+	}
 
 	for {
 		conn, err := ln.Accept()
@@ -579,21 +597,62 @@ func StartServer(nodeID, minerAddress string) {
 			log.Panic(err)
 		}
 
-		if bc != nil {
-			bc = NewBlockchain(nodeID)
-		}
-
 		// print the state of that node
 		fmt.Printf("========My Address: %s=========Miner: %s=============\n", nodeAddress, miningAddress)
 		fmt.Printf("Neighbor: %s\n", knownNodes)
 		fmt.Printf("Full Node: %s\n", fullNodes)
 		fmt.Println("=========================================================================")
 
-		go handleConnection(conn, bc)
+		go handleConnection(conn, getLocalChain())
 	}
 
 }
 
+// handleShutdown persists the mempool when the node is interrupted.
+func handleShutdown(nodeID string, ln net.Listener) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-sigs
+	fmt.Printf("Received %s, shutting down...\n", sig)
+
+	ln.Close()
+	stopNode(nodeID)
+}
+
+// stopNode persists the state of the node and exits. A block which is being
+// connected is finished first and none is connected after it.
+func stopNode(nodeID string) {
+	if miningLoop != nil {
+		miningLoop.Pause()
+	}
+
+	bc := getLocalChain()
+	if bc != nil {
+		bc.lock.Lock()
+	}
+
+	SaveMempool(nodeID)
+	if bc != nil {
+		bc.db.Close()
+	}
+	os.Exit(0)
+}
+
+func getLocalChain() *Blockchain {
+	localChainLock.Lock()
+	defer localChainLock.Unlock()
+
+	return localChain
+}
+
+func setLocalChain(bc *Blockchain) {
+	localChainLock.Lock()
+	defer localChainLock.Unlock()
+
+	localChain = bc
+}
+
 func gobEncode(data interface{}) []byte {
 	var buff bytes.Buffer
 
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const spvDBFile = "spv_%s.db"
+
+// maps block hash to BlockHeader, "l" to the hash of the best header
+const spvHeadersBucket = "headers"
+
+// maps the big endian height to the block hash
+const spvHeightsBucket = "heights"
+
+// maps block hash to filter header, "l" to the hash of the last filtered block
+const spvFilterHeadersBucket = "filterheaders"
+
+// maps txid to SPVTransaction
+const spvTransactionsBucket = "transactions"
+
+var spvSyncInterval = 10 * time.Second
+
+// SPVNode is a light node. It keeps the block headers and the transactions of
+// its wallet, which are proven against the headers, but neither blocks nor
+// the UTXO set.
+type SPVNode struct {
+	db           *bolt.DB
+	peer         string
+	pubKeyHashes [][]byte
+}
+
+// SPVTransaction is a wallet transaction and the block confirming it.
+type SPVTransaction struct {
+	Transaction Transaction
+	BlockHash   []byte
+	Height      int
+}
+
+func (t SPVTransaction) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(t)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeSPVTransaction(data []byte) SPVTransaction {
+	var transaction SPVTransaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&transaction)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return transaction
+}
+
+func heightKey(height int) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(height))
+
+	return key
+}
+
+// NewSPVNode opens the headers and transactions of nodeID, which sync from peer
+// for the wallet addresses with pubKeyHashes.
+func NewSPVNode(nodeID, peer string, pubKeyHashes [][]byte) *SPVNode {
+	db, err := bolt.Open(fmt.Sprintf(spvDBFile, nodeID), 0600, nil)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{spvHeadersBucket, spvHeightsBucket, spvFilterHeadersBucket, spvTransactionsBucket} {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return &SPVNode{db, peer, pubKeyHashes}
+}
+
+func (n *SPVNode) Close() {
+	n.db.Close()
+}
+
+// Tip returns the best header, false if there are no headers yet.
+func (n *SPVNode) Tip() (BlockHeader, bool) {
+	var header BlockHeader
+	found := false
+
+	err := n.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(spvHeadersBucket))
+		if tip := b.Get([]byte("l")); tip != nil {
+			header = DeserializeBlockHeader(b.Get(tip))
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return header, found
+}
+
+func (n *SPVNode) GetHeader(hash []byte) (BlockHeader, error) {
+	var header BlockHeader
+
+	err := n.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(spvHeadersBucket)).Get(hash)
+		if data == nil {
+			return errors.New("Header is not found.")
+		}
+
+		header = DeserializeBlockHeader(data)
+		return nil
+	})
+
+	return header, err
+}
+
+func (n *SPVNode) GetHeaderHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := n.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(spvHeightsBucket)).Get(heightKey(height))
+		if data == nil {
+			return errors.New("Header height is out of range.")
+		}
+
+		hash = append([]byte{}, data...)
+		return nil
+	})
+
+	return hash, err
+}
+
+// syncHeaders downloads the headers after the best one, checks that they
+// extend it and their pow, and returns how many were added.
+func (n *SPVNode) syncHeaders() (int, error) {
+	count := 0
+
+	for {
+		tip, ok := n.Tip()
+
+		var start []byte
+		if ok {
+			start = tip.Hash
+		}
+		received, err := requestHeaders(n.peer, start, maxHeadersPerRequest)
+		if err != nil {
+			return count, err
+		}
+
+		// the headers start with the best one, which is known already
+		if ok {
+			if len(received) == 0 || !bytes.Equal(received[0].Hash, tip.Hash) {
+				return count, errors.New("Headers don't start with the best header.")
+			}
+			received = received[1:]
+		}
+		if len(received) == 0 {
+			return count, nil
+		}
+
+		prev := &tip
+		if !ok {
+			prev = nil
+		}
+		for i := range received {
+			header := received[i]
+
+			if prev == nil {
+				if len(header.PrevBlockHash) != 0 || header.Height != 0 {
+					return count, errors.New("The first header is not the genesis block.")
+				}
+			} else if !bytes.Equal(header.PrevBlockHash, prev.Hash) || header.Height != prev.Height+1 {
+				return count, fmt.Errorf("Header %x doesn't extend %x.", header.Hash, prev.Hash)
+			}
+			if !ValidateHeader(header) {
+				return count, fmt.Errorf("Header %x has invalid PoW.", header.Hash)
+			}
+
+			prev = &received[i]
+		}
+
+		err = n.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(spvHeadersBucket))
+			heights := tx.Bucket([]byte(spvHeightsBucket))
+
+			for _, header := range received {
+				err := b.Put(header.Hash, header.Serialize())
+				if err != nil {
+					return err
+				}
+				err = heights.Put(heightKey(header.Height), header.Hash)
+				if err != nil {
+					return err
+				}
+			}
+
+			return b.Put([]byte("l"), prev.Hash)
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+
+		count += len(received)
+	}
+}
+
+// filterTip returns the height of the next block to filter and the filter
+// header of the block before it.
+func (n *SPVNode) filterTip() (int, []byte) {
+	height := 0
+	prevHeader := make([]byte, sha256.Size)
+
+	err := n.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(spvFilterHeadersBucket))
+		last := b.Get([]byte("l"))
+		if last == nil {
+			return nil
+		}
+
+		header := DeserializeBlockHeader(tx.Bucket([]byte(spvHeadersBucket)).Get(last))
+		height = header.Height + 1
+		prevHeader = append([]byte{}, b.Get(last)...)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return height, prevHeader
+}
+
+// matcher watches the wallet addresses and the outputs paid to them.
+func (n *SPVNode) matcher() *FilterMatcher {
+	m := NewFilterMatcher(n.pubKeyHashes)
+
+	for _, t := range n.Transactions() {
+		for i, out := range t.Transaction.Vout {
+			if n.isMine(out.PubKeyHash) {
+				m.AddOutpoint(t.Transaction.ID, i)
+			}
+		}
+	}
+
+	return m
+}
+
+func (n *SPVNode) isMine(pubKeyHash []byte) bool {
+	for _, mine := range n.pubKeyHashes {
+		if bytes.Equal(mine, pubKeyHash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncFilters checks the filters of the headers not filtered yet and fetches
+// the transactions of the matching blocks. It returns the new transactions.
+func (n *SPVNode) syncFilters() ([]SPVTransaction, error) {
+	var found []SPVTransaction
+
+	tip, ok := n.Tip()
+	if !ok {
+		return found, nil
+	}
+
+	matcher := n.matcher()
+	for {
+		start, prevHeader := n.filterTip()
+		if start > tip.Height {
+			return found, nil
+		}
+
+		stop := start + maxCFiltersPerRequest - 1
+		if stop > tip.Height {
+			stop = tip.Height
+		}
+		stopHash, err := n.GetHeaderHashByHeight(stop)
+		if err != nil {
+			return found, err
+		}
+
+		headers, err := requestCFHeaders(n.peer, start, stopHash)
+		if err != nil {
+			return found, err
+		}
+		filters, err := requestCFilters(n.peer, start, stopHash)
+		if err != nil {
+			return found, err
+		}
+		err = VerifyCFilters(filters, headers, prevHeader)
+		if err != nil {
+			return found, err
+		}
+		if len(filters.BlockHashes) != stop-start+1 {
+			return found, errors.New("Filters don't cover the requested blocks.")
+		}
+
+		for i, blockHash := range filters.BlockHashes {
+			hash, err := n.GetHeaderHashByHeight(start + i)
+			if err != nil {
+				return found, err
+			}
+			if !bytes.Equal(hash, blockHash) {
+				return found, fmt.Errorf("Filter of block %x is not on the header chain.", blockHash)
+			}
+
+			if !matcher.Match(blockHash, filters.Filters[i]) {
+				continue
+			}
+
+			transactions, err := n.fetchTransactions(blockHash)
+			if err != nil {
+				return found, err
+			}
+			for _, t := range transactions {
+				for vout, out := range t.Transaction.Vout {
+					if n.isMine(out.PubKeyHash) {
+						matcher.AddOutpoint(t.Transaction.ID, vout)
+					}
+				}
+			}
+			found = append(found, transactions...)
+		}
+
+		err = n.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(spvFilterHeadersBucket))
+			for i, blockHash := range filters.BlockHashes {
+				err := b.Put(blockHash, headers[i])
+				if err != nil {
+					return err
+				}
+			}
+
+			return b.Put([]byte("l"), stopHash)
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// fetchTransactions gets the wallet transactions of a block with their
+// merkle proofs, and stores them once the proofs check out.
+func (n *SPVNode) fetchTransactions(blockHash []byte) ([]SPVTransaction, error) {
+	header, err := n.GetHeader(blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	mb, err := requestMerkleBlock(n.peer, blockHash, n.pubKeyHashes)
+	if err != nil {
+		return nil, err
+	}
+	err = VerifyMerkleBlock(mb, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []SPVTransaction
+	for _, tx := range mb.Transactions {
+		transactions = append(transactions, SPVTransaction{*tx, header.Hash, header.Height})
+	}
+
+	err = n.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(spvTransactionsBucket))
+		for _, t := range transactions {
+			err := b.Put(t.Transaction.ID, t.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return transactions, nil
+}
+
+// Transactions returns the wallet transactions in chain order.
+func (n *SPVNode) Transactions() []SPVTransaction {
+	var transactions []SPVTransaction
+
+	err := n.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(spvTransactionsBucket)).ForEach(func(k, v []byte) error {
+			transactions = append(transactions, DeserializeSPVTransaction(v))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Height < transactions[j].Height
+	})
+
+	return transactions
+}
+
+// Balance sums the outputs paid to the wallet which no wallet transaction spends.
+func (n *SPVNode) Balance() int {
+	transactions := n.Transactions()
+
+	spent := make(map[string]bool)
+	for _, t := range transactions {
+		if t.Transaction.IsCoinbase() {
+			continue
+		}
+		for _, vin := range t.Transaction.Vin {
+			spent[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+
+	balance := 0
+	for _, t := range transactions {
+		for i, out := range t.Transaction.Vout {
+			if n.isMine(out.PubKeyHash) && !spent[outpointKey(t.Transaction.ID, i)] {
+				balance += out.Value
+			}
+		}
+	}
+
+	return balance
+}
+
+// Sync catches up with the headers and the wallet transactions of the peer.
+func (n *SPVNode) Sync() error {
+	count, err := n.syncHeaders()
+	if err != nil {
+		return err
+	}
+
+	found, err := n.syncFilters()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 || len(found) > 0 {
+		tip, _ := n.Tip()
+		fmt.Printf("Synced %d headers from %s, best height %d\n", count, n.peer, tip.Height)
+		for _, t := range n.Transactions() {
+			fmt.Printf("Transaction %x in block %d, %d confirmations\n", t.Transaction.ID, t.Height, tip.Height-t.Height+1)
+		}
+		fmt.Printf("Balance: %d\n", n.Balance())
+	}
+
+	return nil
+}
+
+// Run syncs with the peer every spvSyncInterval.
+func (n *SPVNode) Run() {
+	for {
+		err := n.Sync()
+		if err != nil {
+			fmt.Printf("Failed to sync with %s: %s\n", n.peer, err)
+		}
+
+		time.Sleep(spvSyncInterval)
+	}
+}
+
+// StartSPVNode runs a light node for the wallet of nodeID against the first full node.
+func StartSPVNode(nodeID string) {
+	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+
+	wallets, err := NewWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var pubKeyHashes [][]byte
+	for _, address := range wallets.GetAddresses() {
+		pubKeyHashes = append(pubKeyHashes, AddressToPubKeyHash(address))
+	}
+
+	node := NewSPVNode(nodeID, fullNodes[0], pubKeyHashes)
+	fmt.Printf("Syncing headers from %s for %d addresses\n", fullNodes[0], len(pubKeyHashes))
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+		sig := <-sigs
+		fmt.Printf("Received %s, shutting down...\n", sig)
+		node.Close()
+		os.Exit(0)
+	}()
+
+	node.Run()
+}
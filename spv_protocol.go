@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"log"
+	"net"
+)
+
+const maxHeadersPerRequest = 2000
+
+// getheaders asks for up to Count headers from StartHash towards the tip,
+// from the genesis block if StartHash is empty.
+type getheaders struct {
+	AddrFrom  string
+	StartHash []byte
+	Count     int
+}
+
+type headers struct {
+	Headers []BlockHeader
+	Error   string
+}
+
+// getmerkleblk asks for the transactions of a block which pay to or spend
+// from PubKeyHashes, each with a proof against the merkle root of the header.
+type getmerkleblk struct {
+	AddrFrom     string
+	BlockHash    []byte
+	PubKeyHashes [][]byte
+}
+
+type merkleblock struct {
+	Header       BlockHeader
+	TxCount      int
+	Transactions []*Transaction
+	Proofs       []MerkleProof
+	Error        string
+}
+
+// txMatches reports whether tx pays to or spends from one of pubKeyHashes.
+func txMatches(tx *Transaction, pubKeyHashes map[string]bool) bool {
+	for _, out := range tx.Vout {
+		if pubKeyHashes[string(out.PubKeyHash)] {
+			return true
+		}
+	}
+
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			if pubKeyHashes[string(HashPubKey(vin.PubKey))] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func handleGetHeaders(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload getheaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if bc == nil {
+		respond(conn, "headers", headers{Error: "I don't have a blockchain."})
+		return
+	}
+
+	startHash := payload.StartHash
+	if len(startHash) == 0 {
+		startHash, err = bc.GetBlockHashByHeight(0)
+		if err != nil {
+			respond(conn, "headers", headers{Error: err.Error()})
+			return
+		}
+	}
+
+	count := payload.Count
+	if count <= 0 || count > maxHeadersPerRequest {
+		count = maxHeadersPerRequest
+	}
+
+	result, err := bc.GetHeaders(startHash, count)
+	if err != nil {
+		respond(conn, "headers", headers{Error: err.Error()})
+		return
+	}
+
+	respond(conn, "headers", headers{Headers: result})
+}
+
+func handleGetMerkleBlock(conn net.Conn, request []byte, bc *Blockchain) {
+	var buff bytes.Buffer
+	var payload getmerkleblk
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if bc == nil {
+		respond(conn, "merkleblock", merkleblock{Error: "I don't have a blockchain."})
+		return
+	}
+
+	block, err := bc.GetBlock(payload.BlockHash)
+	if err != nil {
+		respond(conn, "merkleblock", merkleblock{Error: err.Error()})
+		return
+	}
+
+	pubKeyHashes := make(map[string]bool)
+	for _, pubKeyHash := range payload.PubKeyHashes {
+		pubKeyHashes[string(pubKeyHash)] = true
+	}
+
+	var leaves [][]byte
+	for _, tx := range block.Transactions {
+		leaves = append(leaves, tx.Serialize())
+	}
+	tree := NewMerkleTree(leaves)
+
+	response := merkleblock{Header: block.Header(), TxCount: len(block.Transactions)}
+	for i, tx := range block.Transactions {
+		if !txMatches(tx, pubKeyHashes) {
+			continue
+		}
+
+		proof, err := tree.Proof(i)
+		if err != nil {
+			log.Panic(err)
+		}
+		response.Transactions = append(response.Transactions, tx)
+		response.Proofs = append(response.Proofs, *proof)
+	}
+
+	respond(conn, "merkleblock", response)
+}
+
+// requestHeaders asks the node at addr for up to count headers from startHash.
+func requestHeaders(addr string, startHash []byte, count int) ([]BlockHeader, error) {
+	payload := gobEncode(getheaders{nodeAddress, startHash, count})
+	response, err := requestData(addr, append(commandToBytes("getheaders"), payload...))
+	if err != nil {
+		return nil, err
+	}
+
+	var result headers
+	err = gob.NewDecoder(bytes.NewReader(response[commandLength:])).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return result.Headers, nil
+}
+
+// requestMerkleBlock asks the node at addr for the transactions of the block
+// concerning pubKeyHashes. The proofs are not checked here.
+func requestMerkleBlock(addr string, blockHash []byte, pubKeyHashes [][]byte) (*merkleblock, error) {
+	payload := gobEncode(getmerkleblk{nodeAddress, blockHash, pubKeyHashes})
+	response, err := requestData(addr, append(commandToBytes("getmerkleblk"), payload...))
+	if err != nil {
+		return nil, err
+	}
+
+	var result merkleblock
+	err = gob.NewDecoder(bytes.NewReader(response[commandLength:])).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return &result, nil
+}
+
+// VerifyMerkleBlock checks that every transaction of mb is in the block with
+// the merkle root of header.
+func VerifyMerkleBlock(mb *merkleblock, header BlockHeader) error {
+	if !bytes.Equal(mb.Header.Hash, header.Hash) || !bytes.Equal(mb.Header.MerkleRoot, header.MerkleRoot) {
+		return errors.New("Merkle block doesn't match the header.")
+	}
+	if len(mb.Transactions) != len(mb.Proofs) {
+		return errors.New("The number of transactions and proofs differs.")
+	}
+
+	for i, tx := range mb.Transactions {
+		proof := mb.Proofs[i]
+		if proof.Index >= mb.TxCount || !proof.Verify(tx.Serialize(), header.MerkleRoot) {
+			return errors.New("Invalid merkle proof in merkle block.")
+		}
+	}
+
+	return nil
+}
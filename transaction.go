@@ -2,17 +2,17 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/hex"
-	"math/big"
+	"errors"
 	"strings"
 
 	"encoding/gob"
 	"fmt"
 	"log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
 const subsidy = 10
@@ -27,6 +27,15 @@ func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
 }
 
+func (tx *Transaction) OutputValue() int {
+	value := 0
+	for _, out := range tx.Vout {
+		value += out.Value
+	}
+
+	return value
+}
+
 func (tx *Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
@@ -50,25 +59,75 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey) {
+// UnsignedHash is the hash of tx without its signatures, i.e. the ID which
+// it got before it was signed.
+func (tx *Transaction) UnsignedHash() []byte {
+	txCopy := *tx
+	txCopy.Vin = nil
+	for _, vin := range tx.Vin {
+		txCopy.Vin = append(txCopy.Vin, TXInput{vin.Txid, vin.Vout, nil, vin.PubKey})
+	}
+
+	return txCopy.Hash()
+}
+
+// SignatureHash is the hash every input signs, it covers the outpoints and the outputs.
+func (tx *Transaction) SignatureHash() []byte {
+	txCopy := tx.TrimmedCopy()
+
+	return txCopy.Hash()
+}
+
+// Sign signs every input with privKey.
+func (tx *Transaction) Sign(privKey *btcec.PrivateKey) {
 	if tx.IsCoinbase() {
 		return
 	}
 
-	txCopy := tx.TrimmedCopy()
+	hash := tx.SignatureHash()
 
-	for inID, _ := range txCopy.Vin {
+	for inID := range tx.Vin {
+		tx.signInput(inID, privKey, hash)
+	}
+}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.Hash())
+// SignInput signs the input inID with privKey, so that the inputs of a
+// transaction may be signed by different keys.
+func (tx *Transaction) SignInput(inID int, privKey *btcec.PrivateKey) {
+	tx.signInput(inID, privKey, tx.SignatureHash())
+}
 
+// signInput puts a signature of hash into the input inID: by BIP340 Schnorr if
+// the input has an x-only public key, else by a DER signature with low S,
+// RFC 6979 makes it deterministic.
+func (tx *Transaction) signInput(inID int, privKey *btcec.PrivateKey, hash []byte) {
+	if len(tx.Vin[inID].PubKey) == schnorrPubKeyLen {
+		signature, err := schnorr.Sign(privKey, hash)
 		if err != nil {
 			log.Panic(err)
 		}
 
-		signature := append(r.Bytes(), s.Bytes()...)
+		tx.Vin[inID].Signature = signature.Serialize()
+		return
+	}
+
+	tx.Vin[inID].Signature = ecdsa.Sign(privKey, hash).Serialize()
+}
+
+// ParseSignature accepts only strict DER signatures with low S, so that
+// a signature can't be changed into another valid one.
+func ParseSignature(signature []byte) (*ecdsa.Signature, error) {
+	parsed, err := ecdsa.ParseDERSignature(signature)
+	if err != nil {
+		return nil, err
+	}
 
-		tx.Vin[inID].Signature = signature
+	// Serialize encodes the low S form
+	if !bytes.Equal(parsed.Serialize(), signature) {
+		return nil, errors.New("Signature is not canonical.")
 	}
+
+	return parsed, nil
 }
 
 func (tx *Transaction) String() string {
@@ -114,43 +173,79 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 
 // Only check signatures here. Others are left to blockchain.go
 func (tx *Transaction) Verify() bool {
+	return tx.verify(nil)
+}
+
+// verify checks the ECDSA signatures and the Schnorr ones, unless it leaves
+// those to batch.
+func (tx *Transaction) verify(batch *SchnorrBatch) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	hash := tx.SignatureHash()
 
-	for _, vin := range tx.Vin {
+	for inID := range tx.Vin {
+		if !tx.verifyInput(inID, hash, batch) {
+			return false
+		}
+	}
+	return true
+}
 
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
+// VerifyInput checks the signature of the input inID only, so that the inputs
+// of a transaction may be checked while others aren't signed yet.
+func (tx *Transaction) VerifyInput(inID int) bool {
+	return tx.verifyInput(inID, tx.SignatureHash(), nil)
+}
 
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
+func (tx *Transaction) verifyInput(inID int, hash []byte, batch *SchnorrBatch) bool {
+	vin := tx.Vin[inID]
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
+	if len(vin.PubKey) == schnorrPubKeyLen {
+		pubKey, err := schnorr.ParsePubKey(vin.PubKey)
+		if err != nil {
+			return false
+		}
 
-		if ecdsa.Verify(&rawPubKey, txCopy.Hash(), &r, &s) == false {
+		signature, err := schnorr.ParseSignature(vin.Signature)
+		if err != nil {
 			return false
 		}
+
+		if batch != nil {
+			batch.Add(vin.PubKey, hash, vin.Signature)
+			return true
+		}
+		return signature.Verify(hash, pubKey)
 	}
-	return true
+
+	pubKey, err := ParsePubKey(vin.PubKey)
+	if err != nil {
+		return false
+	}
+
+	signature, err := ParseSignature(vin.Signature)
+	if err != nil {
+		return false
+	}
+
+	return signature.Verify(hash, pubKey)
 }
 
 func NewCoinbaseTX(to, data string) *Transaction {
+	return NewCoinbaseTXValue(to, data, subsidy)
+}
+
+// NewCoinbaseTXValue creates a coinbase paying value, which is the subsidy plus
+// the fees of the transactions in the block.
+func NewCoinbaseTXValue(to, data string, value int) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
 
 	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
+	txout := NewTXOutput(value, to)
 	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
 	tx.ID = tx.Hash()
 
@@ -158,39 +253,63 @@ func NewCoinbaseTX(to, data string) *Transaction {
 }
 
 func NewUTXOTransaction(wallet *Wallet, to string, amount int, UTXOSet *UTXOSet) *Transaction {
-	var inputs []TXInput
-	var outputs []TXOutput
+	tx, _, err := NewPaymentTransaction(wallet, []TXOutput{*NewTXOutput(amount, to)}, UTXOSet, defaultCoinSelector, 0)
+	if err != nil {
+		log.Panic("ERROR: ", err)
+	}
 
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	acc, validOutputs := UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
+	return tx
+}
 
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+// NewPaymentTransaction pays outputs from the coins of wallet which the strategy
+// selects, with a fee of feeRate coins per 1000 bytes, and sends the change back.
+func NewPaymentTransaction(wallet *Wallet, outputs []TXOutput, UTXOSet *UTXOSet, strategy string, feeRate float64) (*Transaction, *CoinSelection, error) {
+	if feeRate < 0 {
+		return nil, nil, errors.New("The fee rate is negative.")
 	}
 
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
-		}
+	target := 0
+	for _, out := range outputs {
+		target += out.Value
+	}
 
-		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
-			inputs = append(inputs, input)
-		}
+	pubKeyHash := HashPubKey(wallet.PublicKey)
+	coins := UTXOSet.FindCoins(pubKeyHash)
+	costs := estimateCoinCosts(wallet, outputs, feeRate)
+
+	selection, err := SelectCoins(strategy, coins, target, costs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var inputs []TXInput
+	for _, coin := range selection.Coins {
+		inputs = append(inputs, TXInput{coin.TxID, coin.Vout, nil, wallet.PublicKey})
 	}
 
-	from := fmt.Sprintf("%s", wallet.GetAddress())
-	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+	outputs = append([]TXOutput{}, outputs...)
+	if selection.Change > 0 {
+		outputs = append(outputs, TXOutput{selection.Change, pubKeyHash})
 	}
 
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
 	UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
 
-	return &tx
+	return &tx, selection, nil
+}
+
+// ParseTransaction decodes untrusted data and reports malformed input instead of panicking.
+func ParseTransaction(data []byte) (*Transaction, error) {
+	var transaction Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
 }
 
 func DeserializeTransaction(data []byte) Transaction {
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+// maps txid to TxLocation, exists only if the node runs with -txindex
+const txIndexBucket = "txindex"
+
+// set by startnode -txindex, builds the txindex of an existing chain
+var txIndexEnabled = false
+
+// TxLocation is the position of a confirmed transaction in its block.
+type TxLocation struct {
+	BlockHash []byte
+	Position  int
+}
+
+func (l TxLocation) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(l)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeTxLocation(data []byte) TxLocation {
+	var location TxLocation
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&location)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return location
+}
+
+// initIndexes backfills the block filters and the enabled indexes which the chain doesn't have yet.
+func initIndexes(bc *Blockchain) {
+	// the filters of a chain from before them, or cut short by a stop between
+	// a block and its filter, are built up to the tip
+	if count := bc.BuildFilters(); count > 0 {
+		fmt.Printf("Built the filters of %d blocks.\n", count)
+	}
+
+	if txIndexEnabled && !bc.HasTxIndex() {
+		count := bc.BuildTxIndex()
+		fmt.Printf("Indexed %d transactions.\n", count)
+	}
+
+	if addrIndexEnabled && !bc.HasAddressIndex() {
+		count := bc.BuildAddressIndex()
+		fmt.Printf("Indexed %d address events.\n", count)
+	}
+}
+
+func (bc *Blockchain) HasTxIndex() bool {
+	exists := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return exists
+}
+
+// BuildTxIndex indexes all the transactions of the chain from scratch.
+// Connected blocks are indexed from then on.
+func (bc *Blockchain) BuildTxIndex() int {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	count := 0
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucketName := []byte(txIndexBucket)
+
+		err := tx.DeleteBucket(bucketName)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			log.Panic(err)
+		}
+
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// the blocks are read in this transaction, another one could block it
+		blocks := tx.Bucket([]byte(blocksBucket))
+		for hash := bc.tip; len(hash) > 0; {
+			block := DeserializeBlock(blocks.Get(hash))
+
+			for i, transaction := range block.Transactions {
+				err := b.Put(transaction.ID, TxLocation{block.Hash, i}.Serialize())
+				if err != nil {
+					log.Panic(err)
+				}
+				count++
+			}
+
+			hash = block.PrevBlockHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return count
+}
+
+// indexTransactions adds the transactions of a connected block to the txindex, if there is one.
+func indexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for i, transaction := range block.Transactions {
+		err := b.Put(transaction.ID, TxLocation{block.Hash, i}.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LocateTransaction returns the block containing the transaction ID and its
+// position in there. The chain is scanned from the tip if there is no txindex.
+func (bc *Blockchain) LocateTransaction(ID []byte) (*Block, int, error) {
+	var location []byte
+	indexed := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		if b == nil {
+			return nil
+		}
+
+		indexed = true
+		if data := b.Get(ID); data != nil {
+			location = append([]byte{}, data...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if indexed {
+		if location == nil {
+			return nil, 0, errors.New("Transaction is not found")
+		}
+
+		l := DeserializeTxLocation(location)
+		block, err := bc.GetBlock(l.BlockHash)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return &block, l.Position, nil
+	}
+
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+
+		for i, tx := range block.Transactions {
+			if bytes.Compare(tx.ID, ID) == 0 {
+				return block, i, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, 0, errors.New("Transaction is not found")
+}
@@ -33,7 +33,7 @@ func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[s
 				if out.IsLockedWithKey(pubkeyHash) {
 					accmulated += out.Value
 					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-					if accmulated > amount {
+					if accmulated >= amount {
 						break Work
 					}
 				}
@@ -55,6 +55,36 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) (int, map[string][]int) {
 	return u.FindSpendableOutputs(pubKeyHash, amount)
 }
 
+// FindCoins returns all the unspent outputs locked with pubKeyHash, for a
+// coin selection to choose from.
+func (u UTXOSet) FindCoins(pubKeyHash []byte) []Coin {
+	var coins []Coin
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+
+			for outIdx, out := range outs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					txID := append([]byte{}, k...)
+					coins = append(coins, Coin{txID, outIdx, out.Value})
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return coins
+}
+
 func (u UTXOSet) CountTransactions() int {
 	db := u.Blockchain.db
 	counter := 0
@@ -126,7 +156,7 @@ func (u UTXOSet) Update(block *Block) {
 		for _, tx := range block.Transactions {
 			if tx.IsCoinbase() == false {
 				for _, vin := range tx.Vin {
-					updateOuts := TXOutputs{}
+					updateOuts := TXOutputs{make(map[int]TXOutput)}
 					outsByte := b.Get(vin.Txid)
 					outs := DeserializeOutputs(outsByte)
 
@@ -151,7 +181,7 @@ func (u UTXOSet) Update(block *Block) {
 				}
 			}
 
-			newOutputs := TXOutputs{}
+			newOutputs := TXOutputs{make(map[int]TXOutput)}
 			for outIdx, out := range tx.Vout {
 				newOutputs.Outputs[outIdx] = out
 			}
@@ -176,62 +206,8 @@ func (u UTXOSet) VerifyTransaction(target *Transaction) bool {
 		return true
 	}
 
-	db := u.Blockchain.db
-	result := true
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-
-		count := make(map[int]int)
-		inSum := 0
-		outSum := 0
-
-		for _, vin := range target.Vin {
-			txOutsByte := b.Get(vin.Txid)
-
-			if txOutsByte == nil { // 这样用没有问题？
-				result = false
-				goto End
-			}
-
-			txOuts := DeserializeOutputs(txOutsByte)
-
-			if _, ok := txOuts.Outputs[vin.Vout]; !ok {
-				result = false
-				goto End
-			}
-			count[vin.Vout]++
-			if count[vin.Vout] > 1 {
-				result = false
-				goto End
-			}
-
-			if !vin.UseKey(txOuts.Outputs[vin.Vout].PubKeyHash) {
-				result = false
-				goto End
-			}
-
-			inSum += txOuts.Outputs[vin.Vout].Value
-		}
-
-		for _, vout := range target.Vout {
-			outSum += vout.Value
-		}
-
-		if outSum > inSum {
-			result = false
-			goto End
-		}
-
-	End:
-		return nil
-
-	})
-
-	if err != nil {
-		log.Panic(err)
-	}
-
-	return result && target.Verify()
+	_, ok := NewUTXOView(u).CheckTransaction(target)
+	return ok
 }
 
 // pay attention to coinbase transaction
@@ -251,29 +227,35 @@ func (u UTXOSet) VerifyBlock(b *Block, testPow bool) bool {
 		}
 	}
 
-	// test transactions
-	type UTXOID struct {
-		TxId []byte
-		Vout int
-	}
-
-	count := make(map[string]map[int]int)
+	// test transactions in order, so that a transaction may spend the outputs
+	// of an earlier one in the same block but no utxo is used twice
+	view := NewUTXOView(u)
+	var coinbase *Transaction
+	fees := 0
+	// the Schnorr signatures of all transactions are checked at once
+	batch := &SchnorrBatch{}
 
 	for _, tx := range b.Transactions {
-		// test a transaction
-		if u.VerifyTransaction(tx) == false {
-			return false
-		}
-
-		// pay attention to coinbase transaction
-		// test if use the same utxo in a block
-		for _, vin := range tx.Vin {
-			count[hex.EncodeToString(vin.Txid)][vin.Vout]++
-			if count[hex.EncodeToString(vin.Txid)][vin.Vout] > 1 {
+		if tx.IsCoinbase() {
+			if coinbase != nil {
+				return false
+			}
+			coinbase = tx
+		} else {
+			fee, ok := view.checkTransaction(tx, batch)
+			if !ok {
 				return false
 			}
+			fees += fee
 		}
 
+		view.Connect(tx)
 	}
-	return true
+
+	// the miner may claim the subsidy and the fees, but no more
+	if coinbase != nil && coinbase.OutputValue() > subsidy+fees {
+		return false
+	}
+
+	return batch.Verify()
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+// UTXOView overlays unconfirmed transactions (mempool entries or the earlier
+// transactions of a block) on top of the chainstate, so that a transaction
+// may spend outputs which are not confirmed yet.
+type UTXOView struct {
+	UTXOSet UTXOSet
+	added   map[string]TXOutput
+	spent   map[string]bool
+}
+
+func NewUTXOView(u UTXOSet) *UTXOView {
+	return &UTXOView{u, make(map[string]TXOutput), make(map[string]bool)}
+}
+
+func outpointKey(txid []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txid, vout)
+}
+
+func (v *UTXOView) FetchOutput(txid []byte, vout int) (TXOutput, bool) {
+	key := outpointKey(txid, vout)
+	if v.spent[key] {
+		return TXOutput{}, false
+	}
+
+	if out, ok := v.added[key]; ok {
+		return out, true
+	}
+
+	var out TXOutput
+	found := false
+	err := v.UTXOSet.Blockchain.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		outsByte := b.Get(txid)
+		if outsByte == nil {
+			return nil
+		}
+
+		out, found = DeserializeOutputs(outsByte).Outputs[vout]
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return out, found
+}
+
+// Connect spends the inputs of tx and adds its outputs to the view.
+// The transaction is not verified here.
+func (v *UTXOView) Connect(tx *Transaction) {
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			key := outpointKey(vin.Txid, vin.Vout)
+			v.spent[key] = true
+			delete(v.added, key)
+		}
+	}
+
+	for outIdx, out := range tx.Vout {
+		v.added[outpointKey(tx.ID, outIdx)] = out
+	}
+}
+
+// CheckTransaction verifies a non-coinbase transaction against the view and
+// returns its fee, i.e. the value of its inputs not claimed by its outputs.
+func (v *UTXOView) CheckTransaction(target *Transaction) (int, bool) {
+	return v.checkTransaction(target, nil)
+}
+
+// checkTransaction is CheckTransaction, leaving the Schnorr signatures to batch if it is set.
+func (v *UTXOView) checkTransaction(target *Transaction, batch *SchnorrBatch) (int, bool) {
+	if target.IsCoinbase() || len(target.Vin) == 0 {
+		return 0, false
+	}
+
+	used := make(map[string]bool)
+	inSum := 0
+
+	for _, vin := range target.Vin {
+		key := outpointKey(vin.Txid, vin.Vout)
+		// prevent using the same utxo twice in a transaction
+		if used[key] {
+			return 0, false
+		}
+		used[key] = true
+
+		out, ok := v.FetchOutput(vin.Txid, vin.Vout)
+		if !ok {
+			return 0, false
+		}
+
+		if !vin.UseKey(out.PubKeyHash) {
+			return 0, false
+		}
+
+		inSum += out.Value
+	}
+
+	for _, vout := range target.Vout {
+		if vout.Value < 0 {
+			return 0, false
+		}
+	}
+
+	outSum := target.OutputValue()
+	if outSum > inSum {
+		return 0, false
+	}
+
+	if !target.verify(batch) {
+		return 0, false
+	}
+
+	return inSum - outSum, true
+}
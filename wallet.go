@@ -2,42 +2,112 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"errors"
 	"log"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"golang.org/x/crypto/ripemd160"
 )
 
 const walletVersion = byte(0x00)
 const addressChecksumLen = 4
 
+// public keys are compressed secp256k1 points
+const pubKeyLen = 33
+
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
+	// nil while an encrypted wallet is locked
+	PrivateKey *btcec.PrivateKey
+	// the compressed public key, or the x-only one of a Schnorr key
+	PublicKey []byte
+	// the derivation path of an HD key, empty for a random key
+	Path string
+}
+
+// walletData is how a Wallet is stored, the keys are serialized.
+type walletData struct {
+	// empty if the wallet is encrypted
+	PrivateKey []byte
 	PublicKey  []byte
+	Path       string
 }
 
 func NewWallet() *Wallet {
 	private, public := newKeyPair()
-	wallet := Wallet{private, public}
+	wallet := Wallet{private, public, ""}
 
 	return &wallet
 }
 
+// NewSchnorrWallet creates a key-pair whose address is the hash of the x-only
+// public key, so that its outputs are spent with Schnorr signatures.
+func NewSchnorrWallet() *Wallet {
+	private, _ := newKeyPair()
+	wallet := Wallet{private, schnorr.SerializePubKey(private.PubKey()), ""}
+
+	return &wallet
+}
+
+// IsSchnorr reports whether the wallet signs with Schnorr signatures.
+func (w Wallet) IsSchnorr() bool {
+	return len(w.PublicKey) == schnorrPubKeyLen
+}
+
+func (w Wallet) GobEncode() ([]byte, error) {
+	var result bytes.Buffer
+
+	stored := walletData{PublicKey: w.PublicKey, Path: w.Path}
+	if w.PrivateKey != nil {
+		stored.PrivateKey = w.PrivateKey.Serialize()
+	}
+	err := gob.NewEncoder(&result).Encode(stored)
+
+	return result.Bytes(), err
+}
+
+func (w *Wallet) GobDecode(data []byte) error {
+	var stored walletData
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stored)
+	if err != nil {
+		return err
+	}
+
+	// the public key is kept as stored, compressed or x-only
+	if len(stored.PrivateKey) > 0 {
+		w.PrivateKey, _ = keyPairFromBytes(stored.PrivateKey)
+	}
+	w.PublicKey = stored.PublicKey
+	w.Path = stored.Path
+
+	return nil
+}
+
 func (w Wallet) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
+	return []byte(PubKeyHashToAddress(HashPubKey(w.PublicKey)))
+}
 
+func PubKeyHashToAddress(pubKeyHash []byte) string {
 	walletVersionedPayload := append([]byte{walletVersion}, pubKeyHash...)
 	checksum := checksum(walletVersionedPayload)
 
 	fullPayload := append(walletVersionedPayload, checksum...)
 	address := Base58Encode(fullPayload)
 
-	return address
+	return string(address)
+}
+
+// AddressToPubKeyHash expects a valid address.
+func AddressToPubKeyHash(address string) []byte {
+	pubKeyHash := Base58Decode([]byte(address))
+
+	return pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
 }
 
+// HashPubKey is RIPEMD160(SHA256(pubKey)) of the compressed or the x-only public key.
 func HashPubKey(pubKey []byte) []byte {
 	publicSHA256 := sha256.Sum256(pubKey)
 
@@ -53,6 +123,9 @@ func HashPubKey(pubKey []byte) []byte {
 
 func ValidateAddress(address string) bool {
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= addressChecksumLen {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
 	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
@@ -68,13 +141,27 @@ func checksum(payload []byte) []byte {
 	return secondSHA[:addressChecksumLen]
 }
 
-func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()
-	private, err := ecdsa.GenerateKey(curve, rand.Reader)
+func newKeyPair() (*btcec.PrivateKey, []byte) {
+	private, err := btcec.NewPrivateKey()
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
 
-	return *private, pubKey
+	return private, private.PubKey().SerializeCompressed()
+}
+
+// keyPairFromBytes rebuilds the key-pair of a 32 byte private key.
+func keyPairFromBytes(d []byte) (*btcec.PrivateKey, []byte) {
+	private, public := btcec.PrivKeyFromBytes(d)
+
+	return private, public.SerializeCompressed()
+}
+
+// ParsePubKey accepts only compressed public keys which are points of the curve.
+func ParsePubKey(pubKey []byte) (*btcec.PublicKey, error) {
+	if len(pubKey) != pubKeyLen || pubKey[0] != 0x02 && pubKey[0] != 0x03 {
+		return nil, errors.New("Public key is not compressed.")
+	}
+
+	return btcec.ParsePubKey(pubKey)
 }
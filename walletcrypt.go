@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters of new wallet keys, about 32 MB and 100 ms per unlock
+const (
+	walletScryptN = 1 << 15
+	walletScryptR = 8
+	walletScryptP = 1
+)
+
+var errWalletLocked = errors.New("The wallet is locked, unlock it with walletpassphrase.")
+var errWalletPassphrase = errors.New("The wallet passphrase is incorrect.")
+var errWalletEncrypted = errors.New("The wallet is encrypted already.")
+var errWalletNotEncrypted = errors.New("The wallet is not encrypted.")
+
+// CryptedSecrets are the seed and the private keys of a wallet, sealed with
+// AES-256-GCM under a key derived from the passphrase by scrypt.
+type CryptedSecrets struct {
+	Salt       []byte
+	N          int
+	R          int
+	P          int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// walletSecrets is what CryptedSecrets seal: the seed and the private key of every address.
+type walletSecrets struct {
+	Seed []byte
+	Keys map[string][]byte
+}
+
+func (c *CryptedSecrets) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), c.Salt, c.N, c.R, c.P, 32)
+}
+
+func (c *CryptedSecrets) seal(key []byte, secrets walletSecrets) error {
+	var plaintext bytes.Buffer
+	err := gob.NewEncoder(&plaintext).Encode(secrets)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newWalletAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	c.Nonce = nonce
+	c.Ciphertext = aead.Seal(nil, nonce, plaintext.Bytes(), nil)
+
+	return nil
+}
+
+func (c *CryptedSecrets) open(key []byte) (walletSecrets, error) {
+	var secrets walletSecrets
+
+	aead, err := newWalletAEAD(key)
+	if err != nil {
+		return secrets, err
+	}
+
+	plaintext, err := aead.Open(nil, c.Nonce, c.Ciphertext, nil)
+	if err != nil {
+		return secrets, errWalletPassphrase
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&secrets)
+
+	return secrets, err
+}
+
+func newWalletAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.Crypted != nil
+}
+
+// IsLocked reports whether the private keys are not available.
+func (ws *Wallets) IsLocked() bool {
+	return ws.Crypted != nil && ws.key == nil
+}
+
+func (ws *Wallets) secrets() walletSecrets {
+	secrets := walletSecrets{ws.Seed, make(map[string][]byte)}
+	for address, wallet := range ws.Wallets {
+		secrets.Keys[address] = wallet.PrivateKey.Serialize()
+	}
+
+	return secrets
+}
+
+// Encrypt seals the seed and the private keys with passphrase and locks the wallet.
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return errWalletEncrypted
+	}
+	if passphrase == "" {
+		return errors.New("The passphrase is empty.")
+	}
+
+	crypted := &CryptedSecrets{Salt: make([]byte, 16), N: walletScryptN, R: walletScryptR, P: walletScryptP}
+	_, err := rand.Read(crypted.Salt)
+	if err != nil {
+		return err
+	}
+
+	key, err := crypted.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	err = crypted.seal(key, ws.secrets())
+	if err != nil {
+		return err
+	}
+
+	ws.Crypted = crypted
+	ws.Lock()
+
+	return nil
+}
+
+// Unlock decrypts the seed and the private keys with passphrase.
+func (ws *Wallets) Unlock(passphrase string) error {
+	if !ws.IsEncrypted() {
+		return errWalletNotEncrypted
+	}
+
+	key, err := ws.Crypted.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ws.unlockWithKey(key)
+}
+
+// unlockWithKey decrypts the secrets with the key derived from the passphrase before.
+func (ws *Wallets) unlockWithKey(key []byte) error {
+	secrets, err := ws.Crypted.open(key)
+	if err != nil {
+		return err
+	}
+
+	for address, wallet := range ws.Wallets {
+		d, ok := secrets.Keys[address]
+		if !ok {
+			return errors.New("The private key of " + address + " is missing.")
+		}
+		wallet.PrivateKey, _ = keyPairFromBytes(d)
+	}
+	ws.Seed = secrets.Seed
+	ws.key = key
+
+	return nil
+}
+
+// Lock forgets the seed and the private keys of an encrypted wallet.
+func (ws *Wallets) Lock() {
+	if !ws.IsEncrypted() {
+		return
+	}
+
+	for _, wallet := range ws.Wallets {
+		wallet.PrivateKey = nil
+	}
+	ws.Seed = nil
+	ws.key = nil
+}
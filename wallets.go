@@ -2,18 +2,39 @@ package main
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
 const walletFile = "wallet_%s.dat"
 
+// the number of unused addresses after the last used one which ends the recovery of a chain
+const hdGapLimit = 20
+
 type Wallets struct {
 	Wallets map[string]*Wallet
+	// the BIP39 seed which all keys derive from, empty if the keys are random
+	Seed    []byte
+	Account uint32
+	// the number of keys derived on the external and the internal chain
+	NextIndex [2]uint32
+	// the same for the Schnorr keys
+	NextSchnorrIndex [2]uint32
+	// the watch-only addresses, with the public key if it was imported by key
+	WatchOnly map[string][]byte
+	// the sealed seed and private keys of an encrypted wallet, which aren't stored in the clear then
+	Crypted *CryptedSecrets
+
+	// the key of Crypted while the wallet is unlocked
+	key []byte
 }
 
 func NewWallets(nodeID string) (*Wallets, error) {
@@ -25,7 +46,57 @@ func NewWallets(nodeID string) (*Wallets, error) {
 	return &wallets, err
 }
 
+// NewHDWallets starts an HD wallet for nodeID from the mnemonic, unless the
+// node has a wallet already. The wallet has no keys until they are derived.
+func NewHDWallets(nodeID, mnemonic, passphrase string, account uint32) (*Wallets, error) {
+	if account >= hardenedKeyStart {
+		return nil, errors.New("Account is out of range.")
+	}
+
+	existing, err := NewWallets(nodeID)
+	if err == nil && len(existing.Wallets) > 0 {
+		return nil, errors.New("The node has a wallet already.")
+	}
+
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := Wallets{Wallets: make(map[string]*Wallet), Seed: seed, Account: account}
+
+	return &wallets, nil
+}
+
+// IsHD reports whether the keys derive from a seed.
+func (ws *Wallets) IsHD() bool {
+	return len(ws.Seed) > 0
+}
+
+// MasterFingerprint identifies the seed of the keys, it is nil unless the
+// wallet is HD and unlocked.
+func (ws *Wallets) MasterFingerprint() []byte {
+	if !ws.IsHD() {
+		return nil
+	}
+
+	master, err := NewMasterKey(ws.Seed)
+	if err != nil {
+		return nil
+	}
+
+	return master.Fingerprint()
+}
+
+// CreateWallet adds a key-pair, the next one of the external chain if the wallet is HD.
 func (ws *Wallets) CreateWallet() string {
+	if ws.IsLocked() {
+		log.Panic(errWalletLocked)
+	}
+	if ws.IsHD() {
+		return ws.deriveNext(false, externalChain)
+	}
+
 	wallet := NewWallet()
 	address := fmt.Sprintf("%s", wallet.GetAddress())
 
@@ -34,6 +105,129 @@ func (ws *Wallets) CreateWallet() string {
 	return address
 }
 
+// CreateSchnorrWallet adds a key-pair which signs by Schnorr, the next one of
+// the external chain of the BIP86 keys if the wallet is HD.
+func (ws *Wallets) CreateSchnorrWallet() string {
+	if ws.IsLocked() {
+		log.Panic(errWalletLocked)
+	}
+	if ws.IsHD() {
+		return ws.deriveNext(true, externalChain)
+	}
+
+	wallet := NewSchnorrWallet()
+	address := fmt.Sprintf("%s", wallet.GetAddress())
+
+	ws.Wallets[address] = wallet
+
+	return address
+}
+
+// CreateChangeWallet adds a key-pair for change, the next one of the internal chain if the wallet is HD.
+func (ws *Wallets) CreateChangeWallet() string {
+	if ws.IsLocked() {
+		log.Panic(errWalletLocked)
+	}
+	if ws.IsHD() {
+		return ws.deriveNext(false, internalChain)
+	}
+
+	return ws.CreateWallet()
+}
+
+func (ws *Wallets) deriveWallet(schnorr bool, chain int, index uint32) (*Wallet, error) {
+	master, err := NewMasterKey(ws.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf(hdPath, ws.Account, chain, index)
+	if schnorr {
+		path = fmt.Sprintf(hdSchnorrPath, ws.Account, chain, index)
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if schnorr {
+		return key.SchnorrWallet(path), nil
+	}
+
+	return key.Wallet(path), nil
+}
+
+// nextIndex is the counter of the keys derived on chain.
+func (ws *Wallets) nextIndex(schnorr bool, chain int) *uint32 {
+	if schnorr {
+		return &ws.NextSchnorrIndex[chain]
+	}
+
+	return &ws.NextIndex[chain]
+}
+
+// deriveNext adds the key-pair at the next index of chain.
+func (ws *Wallets) deriveNext(schnorr bool, chain int) string {
+	next := ws.nextIndex(schnorr, chain)
+	for {
+		wallet, err := ws.deriveWallet(schnorr, chain, *next)
+		*next++
+		if err == errInvalidChildKey {
+			continue
+		}
+		if err != nil {
+			log.Panic(err)
+		}
+
+		address := fmt.Sprintf("%s", wallet.GetAddress())
+		ws.Wallets[address] = wallet
+
+		return address
+	}
+}
+
+// Recover derives the ECDSA and the Schnorr keys of both chains up to the last
+// one which used reports, looking gap keys ahead, and returns the number of used keys.
+func (ws *Wallets) Recover(used func(pubKeyHash []byte) bool, gap int) int {
+	found := 0
+
+	for _, schnorr := range []bool{false, true} {
+		found += ws.recoverKeys(schnorr, used, gap)
+	}
+
+	return found
+}
+
+func (ws *Wallets) recoverKeys(schnorr bool, used func(pubKeyHash []byte) bool, gap int) int {
+	found := 0
+
+	for _, chain := range []int{externalChain, internalChain} {
+		unused := 0
+		for index := uint32(0); unused < gap; index++ {
+			wallet, err := ws.deriveWallet(schnorr, chain, index)
+			if err == errInvalidChildKey {
+				continue
+			}
+			if err != nil {
+				log.Panic(err)
+			}
+
+			if !used(HashPubKey(wallet.PublicKey)) {
+				unused++
+				continue
+			}
+
+			for *ws.nextIndex(schnorr, chain) <= index {
+				ws.deriveNext(schnorr, chain)
+			}
+			found++
+			unused = 0
+		}
+	}
+
+	return found
+}
+
 func (ws *Wallets) GetAddresses() []string {
 	var addresses []string
 
@@ -44,6 +238,73 @@ func (ws *Wallets) GetAddresses() []string {
 	return addresses
 }
 
+// ImportAddress watches address without a key to spend from it.
+func (ws *Wallets) ImportAddress(address string) error {
+	if !ValidateAddress(address) {
+		return fmt.Errorf("Invalid address %s.", address)
+	}
+
+	return ws.importWatchOnly(address, nil)
+}
+
+// ImportPubKey watches the address of a compressed or an x-only public key.
+func (ws *Wallets) ImportPubKey(pubKey []byte) (string, error) {
+	var err error
+	if len(pubKey) == schnorrPubKeyLen {
+		_, err = schnorr.ParsePubKey(pubKey)
+	} else {
+		_, err = ParsePubKey(pubKey)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	address := PubKeyHashToAddress(HashPubKey(pubKey))
+
+	return address, ws.importWatchOnly(address, pubKey)
+}
+
+func (ws *Wallets) importWatchOnly(address string, pubKey []byte) error {
+	if ws.Wallets[address] != nil {
+		return fmt.Errorf("The wallet has the key of %s already.", address)
+	}
+
+	if ws.WatchOnly == nil {
+		ws.WatchOnly = make(map[string][]byte)
+	}
+	// a public key imported before is kept
+	if ws.WatchOnly[address] == nil {
+		ws.WatchOnly[address] = pubKey
+	}
+
+	return nil
+}
+
+// GetWatchOnlyAddresses lists the watch-only addresses.
+func (ws *Wallets) GetWatchOnlyAddresses() []string {
+	var addresses []string
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// TrackedPubKeyHashes maps the PubKeyHashes of the addresses whose
+// transactions the wallet tracks to whether the address is watch-only.
+func (ws *Wallets) TrackedPubKeyHashes() map[string]bool {
+	tracked := make(map[string]bool)
+	for address := range ws.WatchOnly {
+		tracked[string(AddressToPubKeyHash(address))] = true
+	}
+	for _, wallet := range ws.Wallets {
+		tracked[string(HashPubKey(wallet.PublicKey))] = false
+	}
+
+	return tracked
+}
+
 func (ws *Wallets) GetWallet(address string) Wallet {
 	// *ws.Wallets[address] <=> *((*ws).Wallets[address])
 	return *ws.Wallets[address]
@@ -61,14 +322,16 @@ func (ws *Wallets) LoadFromFile(nodeID string) error {
 	}
 
 	var wallets Wallets
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
 		log.Panic(err)
 	}
+	if wallets.Wallets == nil {
+		wallets.Wallets = make(map[string]*Wallet)
+	}
 
-	ws.Wallets = wallets.Wallets
+	*ws = wallets
 
 	return nil
 }
@@ -78,17 +341,59 @@ func (ws *Wallets) SaveToFile(nodeID string) {
 	var content bytes.Buffer
 	walletFile := fmt.Sprintf(walletFile, nodeID)
 
-	gob.Register(elliptic.P256())
+	stored := *ws
+	if ws.IsEncrypted() {
+		stored = ws.withoutSecrets()
+	}
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(*ws)
+	err := encoder.Encode(stored)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	// the keys or the seed are in there. The file is replaced at once, so
+	// that it can't be read half written, and a wallet written readable by
+	// others before gets the mode 0600 too.
+	temp, err := ioutil.TempFile(filepath.Dir(walletFile), filepath.Base(walletFile)+".tmp")
 	if err != nil {
 		log.Panic(err)
 	}
+	_, err = temp.Write(content.Bytes())
+	if err == nil {
+		err = temp.Chmod(0600)
+	}
+	if err == nil {
+		err = temp.Close()
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		log.Panic(err)
+	}
+	err = os.Rename(temp.Name(), walletFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	setWalletTracked(nodeID, ws)
+}
+
+// withoutSecrets copies an encrypted wallet without the seed and the private
+// keys, sealing them again if the wallet is unlocked as new keys may be there.
+func (ws *Wallets) withoutSecrets() Wallets {
+	crypted := *ws.Crypted
+	if !ws.IsLocked() {
+		err := crypted.seal(ws.key, ws.secrets())
+		if err != nil {
+			log.Panic(err)
+		}
+		ws.Crypted = &crypted
+	}
+
+	stored := Wallets{Wallets: make(map[string]*Wallet), Account: ws.Account, NextIndex: ws.NextIndex, NextSchnorrIndex: ws.NextSchnorrIndex, WatchOnly: ws.WatchOnly, Crypted: &crypted}
+	for address, wallet := range ws.Wallets {
+		stored.Wallets[address] = &Wallet{PublicKey: wallet.PublicKey, Path: wallet.Path}
+	}
 
+	return stored
 }
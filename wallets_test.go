@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSaveToFileMode(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+
+	nodeID := "wallets_test"
+	wallets, _ := NewWallets(nodeID)
+	wallets.CreateWallet()
+
+	// a wallet from before the files were written with the mode 0600
+	file := fmt.Sprintf(walletFile, nodeID)
+	err = ioutil.WriteFile(file, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkMode := func() {
+		t.Helper()
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("the wallet has the mode %o", info.Mode().Perm())
+		}
+	}
+
+	wallets.SaveToFile(nodeID)
+	checkMode()
+
+	err = os.Chmod(file, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.Encrypt("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallets.SaveToFile(nodeID)
+	checkMode()
+
+	loaded, err := NewWallets(nodeID)
+	if err != nil || !loaded.IsEncrypted() || len(loaded.Wallets) != 1 {
+		t.Fatal("the wallet changes in a round trip", err)
+	}
+
+	files, _ := ioutil.ReadDir(".")
+	if len(files) != 1 {
+		t.Fatalf("%d files are left, the temporary one is not renamed", len(files))
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// maps txid to WalletTransaction, the transactions which spend from or pay
+// to the wallet of the node, confirmed or in the mempool
+const walletTxBucket = "wallettxs"
+
+// the PubKeyHashes which the wallet of each node tracks, read from the wallet
+// file once and replaced whenever the wallet is saved
+var walletTrackedSets = make(map[string]map[string]bool)
+var walletTrackedLock sync.Mutex
+
+// WalletTransaction is a transaction of the wallet and the block confirming it.
+type WalletTransaction struct {
+	Transaction Transaction
+	// nil while the transaction is unconfirmed
+	BlockHash []byte
+	Height    int
+	// when the wallet saw the transaction first, the time of its block if it
+	// was confirmed then
+	Time int64
+	// the value of the wallet outputs which it spends and which it pays to
+	Debit  int
+	Credit int
+	// known if every input spends from the wallet
+	Fee int
+	// whether it spends from or pays to a watch-only address
+	WatchOnly bool
+}
+
+func (t WalletTransaction) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+	err := encoder.Encode(t)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+func DeserializeWalletTransaction(data []byte) WalletTransaction {
+	var transaction WalletTransaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&transaction)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return transaction
+}
+
+func (t WalletTransaction) Confirmed() bool {
+	return t.BlockHash != nil
+}
+
+// Amount is what the transaction adds to the wallet, negative if it pays out.
+func (t WalletTransaction) Amount() int {
+	return t.Credit - t.Debit
+}
+
+// newWalletTransaction tells what tx means to the addresses of tracked, nil
+// if it touches none of them. fetch looks up the outputs which tx spends.
+func newWalletTransaction(tx *Transaction, tracked map[string]bool, fetch func(txid []byte, vout int) (TXOutput, bool)) *WalletTransaction {
+	wtx := &WalletTransaction{Transaction: *tx}
+	involved := false
+
+	isTracked := func(pubKeyHash []byte) bool {
+		watchOnly, ok := tracked[string(pubKeyHash)]
+		if ok {
+			involved = true
+			wtx.WatchOnly = wtx.WatchOnly || watchOnly
+		}
+		return ok
+	}
+
+	if !tx.IsCoinbase() {
+		fromWallet := true
+		for _, vin := range tx.Vin {
+			out, ok := fetch(vin.Txid, vin.Vout)
+			if !ok {
+				// the value is unknown, but the key tells whose input it is
+				isTracked(HashPubKey(vin.PubKey))
+				fromWallet = false
+				continue
+			}
+
+			if isTracked(out.PubKeyHash) {
+				wtx.Debit += out.Value
+			} else {
+				fromWallet = false
+			}
+		}
+		if fromWallet {
+			wtx.Fee = wtx.Debit - tx.OutputValue()
+		}
+	}
+
+	for _, out := range tx.Vout {
+		if isTracked(out.PubKeyHash) {
+			wtx.Credit += out.Value
+		}
+	}
+
+	if !involved {
+		return nil
+	}
+
+	return wtx
+}
+
+// walletTracked returns the addresses which the wallet of the node tracks.
+// The set is shared and must not be changed.
+func (bc *Blockchain) walletTracked() map[string]bool {
+	if bc.nodeID == "" {
+		return nil
+	}
+
+	walletTrackedLock.Lock()
+	defer walletTrackedLock.Unlock()
+
+	tracked, ok := walletTrackedSets[bc.nodeID]
+	if !ok {
+		wallets, err := NewWallets(bc.nodeID)
+		if err == nil {
+			tracked = wallets.TrackedPubKeyHashes()
+		}
+		walletTrackedSets[bc.nodeID] = tracked
+	}
+
+	return tracked
+}
+
+// setWalletTracked replaces the addresses which the wallet of nodeID tracks
+// after keys or watch-only addresses are added to it.
+func setWalletTracked(nodeID string, wallets *Wallets) {
+	tracked := wallets.TrackedPubKeyHashes()
+
+	walletTrackedLock.Lock()
+	defer walletTrackedLock.Unlock()
+
+	walletTrackedSets[nodeID] = tracked
+}
+
+// trackWalletBlock records the transactions of a connected block which
+// involve the wallet, and drops the unconfirmed ones which the block double
+// spends. It must be called before the block is applied to the UTXO set.
+func (bc *Blockchain) trackWalletBlock(block *Block) {
+	tracked := bc.walletTracked()
+	if len(tracked) == 0 {
+		return
+	}
+
+	view := NewUTXOView(UTXOSet{bc})
+	var wtxs []*WalletTransaction
+	for _, tx := range block.Transactions {
+		wtx := newWalletTransaction(tx, tracked, view.FetchOutput)
+		if wtx != nil {
+			wtxs = append(wtxs, wtx)
+		}
+		view.Connect(tx)
+	}
+
+	bc.putWalletBlock(block, wtxs, nil)
+}
+
+// putWalletBlock stores wtxs, the wallet transactions of block, drops the
+// unconfirmed ones which the block double spends and those of stale which
+// are not in the block.
+func (bc *Blockchain) putWalletBlock(block *Block, wtxs []*WalletTransaction, stale [][]byte) {
+	inBlock := make(map[string]bool)
+	spent := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		inBlock[hex.EncodeToString(tx.ID)] = true
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				spent[outpointKey(vin.Txid, vin.Vout)] = true
+			}
+		}
+	}
+	for _, wtx := range wtxs {
+		wtx.BlockHash, wtx.Height, wtx.Time = block.Hash, block.Height, block.Timestamp
+	}
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(walletTxBucket))
+		if err != nil {
+			return err
+		}
+
+		conflicts := walletConflicts(b, inBlock, spent)
+		for _, txID := range stale {
+			if !inBlock[hex.EncodeToString(txID)] {
+				conflicts = append(conflicts, txID)
+			}
+		}
+		for _, txID := range conflicts {
+			err := b.Delete(txID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return putWalletTxs(b, wtxs)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// putWalletTxs stores wtxs, keeping the time when the wallet saw them first.
+func putWalletTxs(b *bolt.Bucket, wtxs []*WalletTransaction) error {
+	for _, wtx := range wtxs {
+		if data := b.Get(wtx.Transaction.ID); data != nil {
+			wtx.Time = DeserializeWalletTransaction(data).Time
+		}
+
+		err := b.Put(wtx.Transaction.ID, wtx.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walletConflicts returns the unconfirmed wallet transactions which spend
+// one of spent, unless they are inBlock, and those which spend their outputs.
+func walletConflicts(b *bolt.Bucket, inBlock, spent map[string]bool) [][]byte {
+	var unconfirmed []WalletTransaction
+	err := b.ForEach(func(k, v []byte) error {
+		wtx := DeserializeWalletTransaction(v)
+		if !wtx.Confirmed() && !inBlock[hex.EncodeToString(k)] {
+			unconfirmed = append(unconfirmed, wtx)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var conflicts [][]byte
+	removed := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+
+		for _, wtx := range unconfirmed {
+			txID := hex.EncodeToString(wtx.Transaction.ID)
+			if removed[txID] {
+				continue
+			}
+
+			for _, vin := range wtx.Transaction.Vin {
+				if spent[outpointKey(vin.Txid, vin.Vout)] || removed[hex.EncodeToString(vin.Txid)] {
+					removed[txID] = true
+					conflicts = append(conflicts, wtx.Transaction.ID)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// trackWalletTx records a transaction accepted to the mempool if it involves
+// the wallet, view has the outputs which it spends.
+func (bc *Blockchain) trackWalletTx(tx *Transaction, view *UTXOView) {
+	tracked := bc.walletTracked()
+	if len(tracked) == 0 {
+		return
+	}
+
+	wtx := newWalletTransaction(tx, tracked, view.FetchOutput)
+	if wtx == nil {
+		return
+	}
+	wtx.Time = time.Now().Unix()
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(walletTxBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(wtx.Transaction.ID, wtx.Serialize())
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// forgetWalletTxs drops the unconfirmed wallet transactions among txs, which
+// were evicted from the mempool.
+func (bc *Blockchain) forgetWalletTxs(txs []*Transaction) {
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(walletTxBucket))
+		if b == nil {
+			return nil
+		}
+
+		for _, transaction := range txs {
+			data := b.Get(transaction.ID)
+			if data == nil || DeserializeWalletTransaction(data).Confirmed() {
+				continue
+			}
+
+			err := b.Delete(transaction.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// WalletTransactions returns the transactions of the wallet, the confirmed
+// ones by height and the unconfirmed ones after them by time.
+func (bc *Blockchain) WalletTransactions() []WalletTransaction {
+	var wtxs []WalletTransaction
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(walletTxBucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			wtxs = append(wtxs, DeserializeWalletTransaction(v))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sort.SliceStable(wtxs, func(i, j int) bool {
+		a, b := wtxs[i], wtxs[j]
+		if a.Confirmed() != b.Confirmed() {
+			return a.Confirmed()
+		}
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		return a.Time < b.Time
+	})
+
+	return wtxs
+}
+
+// WalletBalance is the value of the unspent outputs of the wallet.
+type WalletBalance struct {
+	Confirmed            int
+	Unconfirmed          int
+	WatchOnlyConfirmed   int
+	WatchOnlyUnconfirmed int
+}
+
+// NewWalletBalance sums the outputs of wtxs to the addresses of tracked which
+// no transaction of wtxs spends, unconfirmed spends count as well.
+func NewWalletBalance(wtxs []WalletTransaction, tracked map[string]bool) WalletBalance {
+	spent := make(map[string]bool)
+	for _, wtx := range wtxs {
+		if wtx.Transaction.IsCoinbase() {
+			continue
+		}
+		for _, vin := range wtx.Transaction.Vin {
+			spent[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+
+	var balance WalletBalance
+	for _, wtx := range wtxs {
+		for i, out := range wtx.Transaction.Vout {
+			watchOnly, ok := tracked[string(out.PubKeyHash)]
+			if !ok || spent[outpointKey(wtx.Transaction.ID, i)] {
+				continue
+			}
+
+			switch {
+			case watchOnly && wtx.Confirmed():
+				balance.WatchOnlyConfirmed += out.Value
+			case watchOnly:
+				balance.WatchOnlyUnconfirmed += out.Value
+			case wtx.Confirmed():
+				balance.Confirmed += out.Value
+			default:
+				balance.Unconfirmed += out.Value
+			}
+		}
+	}
+
+	return balance
+}